@@ -2,7 +2,6 @@ package serra
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/chzyer/readline"
@@ -14,6 +13,7 @@ func init() {
 	addCmd.Flags().Int64VarP(&count, "count", "c", 1, "Amount of cards to add")
 	addCmd.Flags().BoolVarP(&unique, "unique", "u", false, "Only add card if not existent yet")
 	addCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Spin up interactive terminal")
+	addCmd.Flags().StringVar(&file, "file", "", "Read cards from a file, one per line (- for stdin)")
 	addCmd.Flags().StringVarP(&set, "set", "s", "", "Filter by set code (usg/mmq/vow)")
 	addCmd.Flags().BoolVarP(&foil, "foil", "f", false, "Add foil variant of card")
 	rootCmd.AddCommand(addCmd)
@@ -23,96 +23,65 @@ var addCmd = &cobra.Command{
 	Aliases:       []string{"a"},
 	Use:           "add",
 	Short:         "Add a card to your collection",
-	Long:          "Adds a card from scryfall to your collection. Amount can be modified using flags",
+	Long:          "Adds a card from scryfall to your collection. Cards are given as set/collector number (usg/13) or by name (\"Lightning Bolt\"). Use - or --file to read cards line by line. Amount can be modified using flags",
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, cards []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
 		if interactive {
-			addCardsInteractive(unique, set)
-		} else {
-			addCards(cards, unique, count)
+			return client.addCardsInteractive(unique, set)
 		}
-		return nil
+		if input := bulkInput(cards); input != "" {
+			return client.runBulk(input, "Added", func(entries []BulkEntry) []BulkResult {
+				return client.addBulk(entries, unique)
+			})
+		}
+		_, err = client.addCards(cards, set, unique, count, foilFinish(foil))
+		return err
 	},
 }
 
-func addCardsInteractive(unique bool, set string) {
-	l := Logger()
+func (client *Client) addCardsInteractive(unique bool, set string) error {
 	if len(set) == 0 {
-		l.Fatal("Option --set <set> must be given in interactive mode")
+		return fmt.Errorf("Option --set <set> must be given in interactive mode")
 	}
 
-	rl, err := readline.New(fmt.Sprintf("%s> ", set))
+	session, err := client.runPrompt(set, lookupScryfall, func(rl *readline.Instance, cards []string, entry *PromptEntry) []CardChange {
+		changes, _ := client.addCards(cards, set, unique, entry.Count, entry.Finish)
+		return changes
+	})
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer rl.Close()
 
-	for {
-		line, err := rl.Readline()
-		if err != nil { // io.EOF
-			break
-		}
-
-		// default is no foil
-		foil = false
-
-		// default is count 1
-		count = 1
-
-		// construct card input for addCards
-		card := []string{}
-
-		// Detect if input contains a dash, if it does it means the user wants to add a range of cards
-		if strings.Contains(line, "-") {
-			// Split input into two parts
-			parts := strings.Split(line, "-")
-			// Check if both parts are numbers
-			if _, err := strconv.Atoi(parts[0]); err == nil {
-				if _, err = strconv.Atoi(parts[1]); err == nil {
-					// Loop over range and add each card to card slice
-					start, _ := strconv.Atoi(parts[0])
-					end, _ := strconv.Atoi(parts[1])
-					for i := start; i <= end; i++ {
-						card = append(card, fmt.Sprintf("%s/%d", set, i))
-					}
-				}
-			}
-		} else {
-			card = append(card, fmt.Sprintf("%s/%s", set, strings.Split(line, " ")[0]))
-		}
-
-		// Are there extra arguments?
-		if len(strings.Split(line, " ")) == 2 {
-
-			// foil shortcut
-			if strings.Split(line, " ")[1] == "f" {
-				foil = true
-			}
+	total, value := session.summary(client.valuation())
+	fmt.Printf("\n%sAdded %d cards worth %s%.2f%s%s in this session\n", Green, total, Yellow, value, client.currencySymbol(), Reset)
+	return nil
+}
 
-			// amount shortcut
-			if amount, err := strconv.Atoi(strings.Split(line, " ")[1]); err == nil {
-				if amount > 1 {
-					count = int64(amount)
-				}
-			}
-		}
+// addCards adds an amount of cards in a finish and returns what was added.
+// Cards given by name are looked up within set, if it is not empty.
+func (client *Client) addCards(cards []string, set string, unique bool, count int64, finish string) ([]CardChange, error) {
+	l := Logger()
 
-		addCards(card, unique, count)
+	if err := checkCount(count); err != nil {
+		return nil, err
 	}
 
-}
+	// cards given by name are looked up on scryfall
+	cards = client.resolveCards(cards, set, lookupScryfall)
 
-func addCards(cards []string, unique bool, count int64) error {
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
-	l := Logger()
-	defer storageDisconnect(client)
+	changes := []CardChange{}
 
 	// Loop over different cards
 	for _, card := range cards {
 		// Extract collector number and set name from card input & trim any leading 0 from collector number
 
-		if !strings.Contains(card, "/") {
+		if !isCardID(card) {
 			l.Errorf("Invalid card format %s. Needs to be set/collector number i.e. \"usg/13\"", card)
 			continue
 		}
@@ -125,56 +94,87 @@ func addCards(cards []string, unique bool, count int64) error {
 			continue
 		}
 
-		// Check if card is already in collection
-		co, err := coll.storageFind(bson.D{{"set", setName}, {"collectornumber", collectorNumber}}, bson.D{}, 0, 0)
+		change, err := client.addCard(setName, collectorNumber, unique, count, finish, nil)
 		if err != nil {
-			l.Error(err)
+			l.Warn(err)
 			continue
 		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	return changes, nil
+}
+
+// addCard adds an amount of a single card in a finish. Cards not in the
+// collection yet are fetched from scryfall, unless they are given already.
+// Nothing is returned if the card is skipped because it exists already.
+func (client *Client) addCard(setName, collectorNumber string, unique bool, count int64, finish string, fetched *Card) (*CardChange, error) {
+	l := Logger()
+	coll := client.cards()
+	v := client.valuation()
+
+	var suffix string
+	if finish != FinishNormal {
+		suffix = ", " + finish
+	}
+
+	// Check if card is already in collection
+	co, err := coll.storageFind(bson.D{{"set", setName}, {"collectornumber", collectorNumber}}, bson.D{}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(co) >= 1 {
+		c := co[0]
+		outputColor := coloredValue(v.cardFinishValue(c, finish))
+
+		if unique {
+			l.Warnf("%dx \"%s\" (%s, %s%.2f%s%s%s) not added, because it already exists", count, c.Name, c.Rarity, outputColor, v.cardFinishValue(c, finish), v.symbol(), Reset, suffix)
+			return nil, nil
+		}
 
-		if len(co) >= 1 {
-			c := co[0]
-			outputColor := coloredValue(c.getValue(foil))
-
-			if unique {
-				l.Warnf("%dx \"%s\" (%s, %s%.2f%s%s) not added, because it already exists", count, c.Name, c.Rarity, outputColor, c.getValue(foil), getCurrency(), Reset)
-				continue
-			}
-
-			modifyCardCount(coll, &c, count, foil)
-
-		} else {
-			// Fetch card from scryfall
-			c, err := fetchCard(setName, collectorNumber)
-			outputColor := coloredValue(c.getValue(foil))
-			if err != nil {
-				l.Warn(err)
-				continue
-			}
-
-			// Write card to mongodb
-			var total int64 = 0
-			if foil {
-				c.SerraCountFoil = count
-				total = c.SerraCountFoil
-			} else {
-				c.SerraCount = count
-				total = c.SerraCount
-			}
-			err = coll.storageAdd(c)
-			if err != nil {
-				l.Warn(err)
-				continue
-			}
-
-			// Give feedback of successfully added card
-			if foil {
-				l.Infof("%dx \"%s\" (%s, %s%.2f%s%s, foil) added", total, c.Name, c.Rarity, outputColor, c.getValue(foil), getCurrency(), Reset)
-			} else {
-				l.Infof("%dx \"%s\" (%s, %s%.2f%s%s) added", total, c.Name, c.Rarity, outputColor, c.getValue(foil), getCurrency(), Reset)
-			}
+		if _, err := modifyCardCount(coll, v, &c, count, finish); err != nil {
+			return nil, err
 		}
+		return &CardChange{Card: c, Finish: finish, Amount: count}, nil
 	}
-	storageDisconnect(client)
-	return nil
+
+	// Fetch card from scryfall
+	c := fetched
+	if c == nil {
+		c, err = client.scryfall.fetchCard(setName, collectorNumber)
+		if err != nil {
+			return nil, err
+		}
+	}
+	outputColor := coloredValue(v.cardFinishValue(*c, finish))
+
+	// Write card to mongodb. The card may have been added in the meantime,
+	// the upsert adds to the stored card then.
+	created, err := coll.storageUpsertCard(c, countField(finish), count, unique)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		if unique {
+			l.Warnf("%dx \"%s\" (%s, %s%.2f%s%s%s) not added, because it already exists", count, c.Name, c.Rarity, outputColor, v.cardFinishValue(*c, finish), v.symbol(), Reset, suffix)
+			return nil, nil
+		}
+		l.Infof("%dx \"%s\" (%s, %s%.2f%s%s%s) added", count, c.Name, c.Rarity, outputColor, v.cardFinishValue(*c, finish), v.symbol(), Reset, suffix)
+		return &CardChange{Card: *c, Finish: finish, Amount: count}, nil
+	}
+
+	switch finish {
+	case FinishFoil:
+		c.SerraCountFoil = count
+	case FinishEtched:
+		c.SerraCountEtched = count
+	default:
+		c.SerraCount = count
+	}
+
+	// Give feedback of successfully added card
+	l.Infof("%dx \"%s\" (%s, %s%.2f%s%s%s) added", count, c.Name, c.Rarity, outputColor, v.cardFinishValue(*c, finish), v.symbol(), Reset, suffix)
+	return &CardChange{Card: *c, Finish: finish, Amount: count, Created: true}, nil
 }
@@ -0,0 +1,313 @@
+package serra
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Input to read bulk entries from stdin
+const bulkStdin = "-"
+
+// Section headers of decklists, which are skipped
+var bulkSections = []string{"deck", "sideboard", "commander", "companion", "maybeboard"}
+
+// Decklist lines like "4 Lightning Bolt (M10) 146 *F*"
+var decklistLine = regexp.MustCompile(`^(?:(\d+)x?\s+)?(.+?)(?:\s+\(([A-Za-z0-9]+)\)(?:\s+(\S+))?)?(?:\s+\*([FE])\*)?$`)
+
+// BulkEntry is a single card of a bulk add or remove, given either by set
+// and collector number or by name
+type BulkEntry struct {
+	Line   int
+	Set    string
+	Number string
+	Name   string
+	Count  int64
+	Finish string
+}
+
+func (e BulkEntry) String() string {
+	if e.Number != "" {
+		return fmt.Sprintf("%s/%s", e.Set, e.Number)
+	}
+	return e.Name
+}
+
+// BulkResult is the outcome of a single line of a bulk add or remove
+type BulkResult struct {
+	Line   int
+	Input  string
+	Change *CardChange
+	Err    error
+}
+
+// bulkInput returns the file to read cards from, if given by --file or as
+// single argument "-"
+func bulkInput(cards []string) string {
+	if file != "" {
+		return file
+	}
+	if len(cards) == 1 && cards[0] == bulkStdin {
+		return bulkStdin
+	}
+	return ""
+}
+
+// runBulk reads all entries of input, applies them and shows a summary
+func (client *Client) runBulk(input, verb string, apply func([]BulkEntry) []BulkResult) error {
+	r, err := openBulkInput(input)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	entries, failed, err := readBulkEntries(r)
+	if err != nil {
+		return err
+	}
+
+	results := failed
+	if len(entries) > 0 {
+		results = append(results, apply(entries)...)
+	}
+	slices.SortStableFunc(results, func(a, b BulkResult) int { return a.Line - b.Line })
+
+	showBulkSummary(client.valuation(), results, verb)
+	return nil
+}
+
+// openBulkInput opens a file or stdin for "-"
+func openBulkInput(path string) (io.ReadCloser, error) {
+	if path == bulkStdin {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// readBulkEntries parses one entry per line. Each line is either like the
+// interactive prompt ("usg/13 2 f", "usg/1-5") or a decklist line
+// ("4 Lightning Bolt (M10) 146"). Lines that cannot be parsed are returned as
+// failed results.
+func readBulkEntries(r io.Reader) ([]BulkEntry, []BulkResult, error) {
+	entries := []BulkEntry{}
+	failed := []BulkResult{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		input := strings.TrimSpace(scanner.Text())
+
+		// skip empty lines, comments and decklist sections
+		if input == "" || strings.HasPrefix(input, "#") || strings.HasPrefix(input, "//") {
+			continue
+		}
+		for _, section := range bulkSections {
+			if strings.EqualFold(strings.TrimSuffix(input, ":"), section) {
+				input = ""
+			}
+		}
+		if input == "" {
+			continue
+		}
+
+		parsed, err := parseBulkLine(input)
+		if err != nil {
+			failed = append(failed, BulkResult{Line: line, Input: input, Err: err})
+			continue
+		}
+		for _, e := range parsed {
+			e.Line = line
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, failed, scanner.Err()
+}
+
+func parseBulkLine(input string) ([]BulkEntry, error) {
+	words := strings.Fields(input)
+
+	// set/number, followed by the same options as in the interactive prompt
+	if isCardID(words[0]) {
+		parts := strings.SplitN(words[0], "/", 2)
+		prompt, err := parsePromptLine(strings.Join(append([]string{parts[1]}, words[1:]...), " "))
+		if err != nil {
+			return nil, err
+		}
+
+		entries := []BulkEntry{}
+		for _, n := range prompt.Numbers {
+			entries = append(entries, BulkEntry{Set: strings.ToLower(parts[0]), Number: n, Count: prompt.Count, Finish: prompt.Finish})
+		}
+		return entries, nil
+	}
+
+	// decklist syntax
+	m := decklistLine.FindStringSubmatch(input)
+	if m == nil {
+		return nil, fmt.Errorf("Invalid line, use set/number [count] [f] or a decklist line like \"4 Lightning Bolt (M10) 146\"")
+	}
+
+	entry := BulkEntry{Name: m[2], Set: strings.ToLower(m[3]), Number: strings.TrimLeft(m[4], "0"), Count: 1, Finish: FinishNormal}
+	if m[1] != "" {
+		count, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("Invalid amount %q", m[1])
+		}
+		entry.Count = count
+	}
+	switch m[5] {
+	case "F":
+		entry.Finish = FinishFoil
+	case "E":
+		entry.Finish = FinishEtched
+	}
+	return []BulkEntry{entry}, nil
+}
+
+// addBulk adds all entries within one storage session. Cards not in the
+// collection yet are looked up on scryfall in batches.
+func (client *Client) addBulk(entries []BulkEntry, unique bool) []BulkResult {
+	coll := client.cards()
+
+	// collect cards, that need to be fetched
+	identifiers := []CardIdentifier{}
+	lookups := map[int]int{}
+	for i, e := range entries {
+		if e.Number != "" {
+			if _, err := findCardByCollectorNumber(coll, e.Set, e.Number); err == nil {
+				continue
+			}
+			lookups[i] = len(identifiers)
+			identifiers = append(identifiers, CardIdentifier{Set: e.Set, CollectorNumber: e.Number})
+			continue
+		}
+		lookups[i] = len(identifiers)
+		identifiers = append(identifiers, CardIdentifier{Name: e.Name, Set: e.Set})
+	}
+
+	fetched, err := client.scryfall.fetchCardCollection(identifiers)
+	if err != nil {
+		results := []BulkResult{}
+		for _, e := range entries {
+			results = append(results, BulkResult{Line: e.Line, Input: e.String(), Err: err})
+		}
+		return results
+	}
+
+	return client.bulkTransaction(entries, func(tx *Client, i int, e BulkEntry) BulkResult {
+		result := BulkResult{Line: e.Line, Input: e.String()}
+
+		var card *Card
+		if j, ok := lookups[i]; ok {
+			card = fetched[j]
+			if card == nil {
+				result.Err = fmt.Errorf("Card not found")
+				return result
+			}
+			// the fetched card is inserted, so every attempt needs its own copy
+			fetchedCopy := *card
+			card = &fetchedCopy
+			e.Set, e.Number = card.Set, card.CollectorNumber
+		}
+
+		result.Change, result.Err = tx.addCard(e.Set, e.Number, unique, e.Count, e.Finish, card)
+		if result.Err == nil && result.Change == nil {
+			result.Err = fmt.Errorf("Card exists already")
+		}
+		return result
+	})
+}
+
+// removeBulk removes all entries within one storage session. Cards given by
+// name are looked up in the collection.
+func (client *Client) removeBulk(entries []BulkEntry) []BulkResult {
+	return client.bulkTransaction(entries, func(tx *Client, i int, e BulkEntry) BulkResult {
+		result := BulkResult{Line: e.Line, Input: e.String()}
+
+		if e.Number == "" {
+			cards, err := findCardsByName(tx.cards(), e.Name, e.Set)
+			switch {
+			case err != nil:
+				result.Err = err
+			case len(cards) == 0:
+				result.Err = fmt.Errorf("Card not found in collection")
+			case len(cards) > 1:
+				result.Err = fmt.Errorf("Card is ambiguous, found %d printings in collection", len(cards))
+			default:
+				e.Set, e.Number = cards[0].Set, cards[0].CollectorNumber
+			}
+			if result.Err != nil {
+				return result
+			}
+		}
+
+		result.Change, result.Err = tx.removeCard(e.Set, e.Number, e.Count, e.Finish, nil)
+		return result
+	})
+}
+
+// bulkTransaction applies all entries within one transaction. Entries that
+// cannot be applied, like unknown cards, are reported as failed. Errors of the
+// storage roll back all entries.
+func (client *Client) bulkTransaction(entries []BulkEntry, apply func(tx *Client, i int, e BulkEntry) BulkResult) []BulkResult {
+	var results []BulkResult
+	err := client.transaction(func(tx *Client) error {
+		// a transaction may be retried, so results start over
+		results = []BulkResult{}
+		for i, e := range entries {
+			result := apply(tx, i, e)
+
+			var storageErr *StorageError
+			if errors.As(result.Err, &storageErr) {
+				return result.Err
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+
+	if err != nil {
+		results = []BulkResult{}
+		for _, e := range entries {
+			results = append(results, BulkResult{Line: e.Line, Input: e.String(), Err: fmt.Errorf("Nothing changed: %w", err)})
+		}
+	}
+	return results
+}
+
+// showBulkSummary prints the amount and value of changed cards and all
+// failed lines
+func showBulkSummary(v valuation, results []BulkResult, verb string) {
+	var (
+		entries int
+		cards   int64
+		value   float64
+		failed  []BulkResult
+	)
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+			continue
+		}
+		entries++
+		cards += r.Change.Amount
+		value += v.changeValue(*r.Change)
+	}
+	if cards < 0 {
+		cards, value = -cards, -value
+	}
+
+	fmt.Printf("\n%s%s %d cards worth %s%.2f%s%s%s from %d entries, %d failed\n", Green, verb, cards, Yellow, value, v.symbol(), Reset, Green, entries, len(failed))
+	fmt.Print(Reset)
+	for _, r := range failed {
+		fmt.Printf("* line %d: %s%s%s: %s\n", r.Line, Purple, r.Input, Reset, r.Err)
+	}
+}
@@ -0,0 +1,36 @@
+package serra
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBulkLine(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []BulkEntry
+	}{
+		{"USG/1-2 f 3", []BulkEntry{
+			{Set: "usg", Number: "1", Count: 3, Finish: FinishFoil},
+			{Set: "usg", Number: "2", Count: 3, Finish: FinishFoil},
+		}},
+		{"4x Lightning Bolt", []BulkEntry{{Name: "Lightning Bolt", Count: 4, Finish: FinishNormal}}},
+		{"1 Lightning Bolt (M10) 0146 *F*", []BulkEntry{{Name: "Lightning Bolt", Set: "m10", Number: "146", Count: 1, Finish: FinishFoil}}},
+		{"2 Fire // Ice (MH2) 290 *E*", []BulkEntry{{Name: "Fire // Ice", Set: "mh2", Number: "290", Count: 2, Finish: FinishEtched}}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseBulkLine(tt.input)
+		if err != nil {
+			t.Errorf("parseBulkLine(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseBulkLine(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+
+	if got, err := parseBulkLine("0 Lightning Bolt"); err == nil {
+		t.Errorf("parseBulkLine() = %+v, want error for an amount of 0", got)
+	}
+}
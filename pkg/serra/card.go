@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func init() {
@@ -16,13 +18,27 @@ func init() {
 	cardCmd.Flags().StringVarP(&sortby, "sort", "s", "name", "How to sort cards (value/number/name/added)")
 	cardCmd.Flags().StringVarP(&name, "name", "n", "", "Name of the card (regex compatible)")
 	cardCmd.Flags().Int64VarP(&cmc, "cmc", "m", -1, "Cumulative mana cost of card")
-	cardCmd.Flags().StringVarP(&color, "color", "i", "", "Color identity of card (w,u,b,r,g)")
+	cardCmd.Flags().StringVarP(&color, "color", "i", "", "Color identity of card (w,u,b,r,g or c for colorless)")
+	cardCmd.Flags().StringVar(&colorMode, "color-mode", ColorExact, "How to match the color identity (exact/includes/within)")
 	cardCmd.Flags().StringVarP(&oracle, "oracle", "o", "", "Contains string in card text")
 	cardCmd.Flags().StringVarP(&cardType, "type", "t", "", "Contains string in card type line")
-	cardCmd.Flags().Int64VarP(&count, "min-count", "c", 0, "Occource more than X in your collection")
+	cardCmd.Flags().StringVarP(&query, "query", "q", "", "Scryfall like search query (t:creature c>=ug cmc<=3 usd>2)")
+	cardCmd.Flags().StringVar(&legal, "legal", "", "Filter by cards legal in format (standard/pioneer/modern/commander/...)")
+	cardCmd.Flags().StringVar(&banned, "banned", "", "Filter by cards banned in format")
+	cardCmd.Flags().StringVar(&restricted, "restricted", "", "Filter by cards restricted in format")
+	cardCmd.Flags().Int64VarP(&minCount, "min-count", "c", 0, "Occource more than X in your collection")
+	cardCmd.Flags().Int64Var(&maxCount, "max-count", 0, "Occource at most X in your collection")
+	cardCmd.Flags().Float64Var(&minValue, "min-value", 0, "Minimum value of a single card")
+	cardCmd.Flags().Float64Var(&maxValue, "max-value", 0, "Maximum value of a single card")
+	cardCmd.Flags().StringVar(&addedAfter, "added-after", "", "Added after date (2024-01-01) or duration (7d, 4w, 6m, 1y)")
+	cardCmd.Flags().StringVar(&addedBefore, "added-before", "", "Added before date (2024-01-01) or duration (7d, 4w, 6m, 1y)")
+	cardCmd.Flags().StringVar(&releasedAfter, "released-after", "", "Released after date (2024-01-01)")
 	cardCmd.Flags().BoolVarP(&detail, "detail", "d", false, "Show details for cards (url)")
 	cardCmd.Flags().BoolVarP(&reserved, "reserved", "w", false, "If card is on reserved list")
 	cardCmd.Flags().BoolVarP(&foil, "foil", "f", false, "If card is foil list")
+	cardCmd.Flags().BoolVar(&foilOnly, "foil-only", false, "Only cards you own as foil only")
+	cardCmd.Flags().BoolVar(&nonfoilOnly, "nonfoil-only", false, "Only cards you own as non foil only")
+	cardCmd.MarkFlagsMutuallyExclusive("foil-only", "nonfoil-only")
 	rootCmd.AddCommand(cardCmd)
 }
 
@@ -32,47 +48,125 @@ var cardCmd = &cobra.Command{
 	Short:   "Search & show cards from your collection",
 	Long: `Search and show cards from your collection.
 If you directly put a card as an argument, it will be displayed
-otherwise you'll get a list of cards as a search result.`,
+otherwise you'll get a list of cards as a search result.
+
+Use --query for a scryfall like search, for example:
+
+  serra card -q 't:creature c>=ug cmc<=3 r:rare usd>2 -o:flying'`,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, cards []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
 		if len(cards) == 0 {
-			cardList := Cards(rarity, set, sortby, name, oracle, cardType, reserved, foil, 0, 0)
-			showCardList(cardList, detail)
-		} else {
-			ShowCard(cards)
+			cardList, err := client.findCards(newCardFilter(), sortby, 0, 0)
+			if err != nil {
+				return err
+			}
+			return render(newCardList(client.valuation(), cardList), func() { showCardList(client.valuation(), cardList, detail) })
 		}
-		return nil
+		return client.showCards(cards)
 	},
 }
 
-func ShowCard(cardids []string) {
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
+func (client *Client) showCards(cardids []string) error {
+	coll := client.cards()
 	l := Logger()
-	defer storageDisconnect(client)
 
+	found := []Card{}
 	for _, v := range cardids {
 		if len(strings.Split(v, "/")) < 2 || strings.Split(v, "/")[1] == "" {
 			l.Warnf("Invalid card %s", v)
 			continue
 		}
 
-		cards, _ := coll.storageFind(bson.D{{"set", strings.Split(v, "/")[0]}, {"collectornumber", strings.Split(v, "/")[1]}}, bson.D{{"name", 1}}, 0, 0)
-
-		for _, card := range cards {
-			showCardDetails(&card)
+		cards, err := coll.storageFind(bson.D{{"set", strings.Split(v, "/")[0]}, {"collectornumber", strings.Split(v, "/")[1]}}, bson.D{{"name", 1}}, 0, 0)
+		if err != nil {
+			return err
 		}
+		found = append(found, cards...)
 	}
+
+	v := client.valuation()
+	details := CardList{}
+	for i := range found {
+		details = append(details, newCardDetailsOutput(v, &found[i]))
+	}
+
+	return render(details, func() {
+		for _, card := range found {
+			showCardDetails(v, &card)
+		}
+	})
 }
 
-func Cards(rarity, set, sortby, name, oracle, cardType string, reserved, foil bool, skip, limit int64) []Card {
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
-	defer storageDisconnect(client)
+// CardFilter holds all criteria to search cards in the collection
+type CardFilter struct {
+	Rarity        string
+	Set           string
+	Name          string
+	Oracle        string
+	Type          string
+	Artist        string
+	Query         string
+	Color         string
+	ColorMode     string
+	Legal         string
+	Banned        string
+	Restricted    string
+	Cmc           int64
+	MinCount      int64
+	MaxCount      int64
+	MinValue      float64
+	MaxValue      float64
+	AddedAfter    string
+	AddedBefore   string
+	ReleasedAfter string
+	Reserved      bool
+	Foil          bool
+	FoilOnly      bool
+	NonfoilOnly   bool
+}
 
+// newCardFilter creates a filter from the command line flags
+func newCardFilter() CardFilter {
+	return CardFilter{
+		Rarity:        rarity,
+		Set:           set,
+		Name:          name,
+		Oracle:        oracle,
+		Type:          cardType,
+		Artist:        artist,
+		Query:         query,
+		Color:         color,
+		ColorMode:     colorMode,
+		Legal:         legal,
+		Banned:        banned,
+		Restricted:    restricted,
+		Cmc:           cmc,
+		MinCount:      minCount,
+		MaxCount:      maxCount,
+		MinValue:      minValue,
+		MaxValue:      maxValue,
+		AddedAfter:    addedAfter,
+		AddedBefore:   addedBefore,
+		ReleasedAfter: releasedAfter,
+		Reserved:      reserved,
+		Foil:          foil,
+		FoilOnly:      foilOnly,
+		NonfoilOnly:   nonfoilOnly,
+	}
+}
+
+// bson converts the filter into a storage query. price returns the price
+// expression of a finish to filter values by.
+func (f CardFilter) bson(price func(foil bool) interface{}) (bson.D, error) {
 	filter := bson.D{}
 
-	switch rarity {
+	switch f.Rarity {
 	case "uncommon":
 		filter = append(filter, bson.E{"rarity", "uncommon"})
 	case "common":
@@ -83,62 +177,177 @@ func Cards(rarity, set, sortby, name, oracle, cardType string, reserved, foil bo
 		filter = append(filter, bson.E{"rarity", "mythic"})
 	}
 
-	var sortStage bson.D
-	switch sortby {
-	case "value":
-		if getCurrency() == EUR {
-			sortStage = bson.D{{"prices.eur", 1}}
-		} else {
-			sortStage = bson.D{{"prices.usd", 1}}
-		}
-	case "number":
-		sortStage = bson.D{{"collectornumber", 1}}
-	case "name":
-		sortStage = bson.D{{"name", 1}}
-	case "added":
-		sortStage = bson.D{{"serra_created", 1}}
-	default:
-		sortStage = bson.D{{"name", 1}}
+	if len(f.Set) > 0 {
+		filter = append(filter, bson.E{"set", f.Set})
 	}
 
-	if len(set) > 0 {
-		filter = append(filter, bson.E{"set", set})
+	if len(f.Name) > 0 {
+		filter = append(filter, bson.E{"name", bson.D{{"$regex", ".*" + f.Name + ".*"}, {"$options", "i"}}})
 	}
 
-	if len(name) > 0 {
-		filter = append(filter, bson.E{"name", bson.D{{"$regex", ".*" + name + ".*"}, {"$options", "i"}}})
+	if len(f.Artist) > 0 {
+		filter = append(filter, bson.E{"artist", bson.D{{"$regex", ".*" + f.Artist + ".*"}, {"$options", "i"}}})
 	}
 
-	if len(artist) > 0 {
-		filter = append(filter, bson.E{"artist", bson.D{{"$regex", ".*" + artist + ".*"}, {"$options", "i"}}})
+	if f.Cmc > -1 {
+		filter = append(filter, bson.E{"cmc", f.Cmc})
 	}
 
-	if cmc > -1 {
-		filter = append(filter, bson.E{"cmc", cmc})
+	if len(f.Oracle) > 0 {
+		filter = append(filter, bson.E{"oracletext", bson.D{{"$regex", ".*" + f.Oracle + ".*"}, {"$options", "i"}}})
 	}
 
-	if len(oracle) > 0 {
-		filter = append(filter, bson.E{"oracletext", bson.D{{"$regex", ".*" + oracle + ".*"}, {"$options", "i"}}})
+	if len(f.Type) > 0 {
+		filter = append(filter, bson.E{"typeline", bson.D{{"$regex", ".*" + f.Type + ".*"}, {"$options", "i"}}})
 	}
 
-	if len(cardType) > 0 {
-		filter = append(filter, bson.E{"typeline", bson.D{{"$regex", ".*" + cardType + ".*"}, {"$options", "i"}}})
+	if len(f.Color) > 0 {
+		colors, err := parseColors(f.Color)
+		if err != nil {
+			return nil, err
+		}
+
+		mode := f.ColorMode
+		if mode == "" {
+			mode = ColorExact
+		}
+		switch mode {
+		case ColorExact, ColorIncludes, ColorWithin:
+		default:
+			return nil, fmt.Errorf("Unknown color mode %q, use %s, %s or %s", mode, ColorExact, ColorIncludes, ColorWithin)
+		}
+		filter = append(filter, colorFilter("coloridentity", colors, mode)...)
 	}
 
-	if len(color) > 0 {
-		colorArr := strings.Split(strings.ToUpper(color), ",")
-		filter = append(filter, bson.E{"coloridentity", colorArr})
+	legalities := []struct{ format, status string }{
+		{f.Legal, "legal"},
+		{f.Banned, "banned"},
+		{f.Restricted, "restricted"},
+	}
+	for _, l := range legalities {
+		if len(l.format) == 0 {
+			continue
+		}
+		format := strings.ToLower(l.format)
+		if !isFormat(format) {
+			return nil, fmt.Errorf("Unknown format %q", l.format)
+		}
+		filter = append(filter, bson.E{"legalities." + format, l.status})
 	}
 
-	if reserved {
+	if f.Reserved {
 		filter = append(filter, bson.E{"reserved", true})
 	}
 
-	if foil {
+	switch {
+	case f.FoilOnly:
+		filter = append(filter, bson.E{"serra_count", 0}, bson.E{"serra_count_foil", bson.D{{"$gt", 0}}})
+	case f.NonfoilOnly:
+		filter = append(filter, bson.E{"serra_count", bson.D{{"$gt", 0}}}, bson.E{"serra_count_foil", 0})
+	case f.Foil:
 		filter = append(filter, bson.E{"serra_count_foil", bson.D{{"$gt", 0}}})
 	}
 
-	cards, _ := coll.storageFind(filter, sortStage, skip, limit)
+	created := bson.D{}
+	now := time.Now()
+	if len(f.AddedAfter) > 0 {
+		date, err := parseSince(f.AddedAfter, now)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, bson.E{"$gte", primitive.NewDateTimeFromTime(date)})
+	}
+
+	if len(f.AddedBefore) > 0 {
+		date, err := parseSince(f.AddedBefore, now)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, bson.E{"$lt", primitive.NewDateTimeFromTime(date)})
+	}
+
+	if len(created) > 0 {
+		filter = append(filter, bson.E{"serra_created", created})
+	}
+
+	if len(f.ReleasedAfter) > 0 {
+		if _, err := time.Parse("2006-01-02", f.ReleasedAfter); err != nil {
+			return nil, fmt.Errorf("Invalid release date %q, use a date like 2024-01-01", f.ReleasedAfter)
+		}
+		// releasedat is stored as string, which sorts like a date
+		filter = append(filter, bson.E{"releasedat", bson.D{{"$gt", f.ReleasedAfter}}})
+	}
+
+	// conditions on computed values need an expression
+	expr := bson.A{}
+	total := bson.D{{"$add", bson.A{"$serra_count", "$serra_count_foil", etchedCount}}}
+	if f.MinCount > 0 {
+		expr = append(expr, bson.D{{"$gte", bson.A{total, f.MinCount}}})
+	}
+
+	if f.MaxCount > 0 {
+		expr = append(expr, bson.D{{"$lte", bson.A{total, f.MaxCount}}})
+	}
+
+	if f.MinValue > 0 {
+		expr = append(expr, bson.D{{"$gte", bson.A{f.priceField(price), f.MinValue}}})
+	}
+
+	if f.MaxValue > 0 {
+		expr = append(expr, bson.D{{"$lte", bson.A{f.priceField(price), f.MaxValue}}})
+	}
+
+	if len(expr) > 0 {
+		filter = append(filter, bson.E{"$expr", bson.D{{"$and", expr}}})
+	}
+
+	queryFilter, err := parseQuery(f.Query)
+	if err != nil {
+		return nil, err
+	}
+	filter = append(filter, queryFilter...)
+
+	return filter, nil
+}
+
+// priceField returns the price of the finish the card is owned in. Cards
+// owned in both finishes are valued by their normal price.
+func (f CardFilter) priceField(price func(foil bool) interface{}) interface{} {
+	switch {
+	case f.FoilOnly:
+		return price(true)
+	case f.NonfoilOnly:
+		return price(false)
+	}
+	return bson.D{{"$cond", bson.A{bson.D{{"$gt", bson.A{"$serra_count", 0}}}, price(false), price(true)}}}
+}
+
+func (client *Client) findCards(f CardFilter, sortby string, skip, limit int64) ([]Card, error) {
+	filter, err := f.bson(client.priceField)
+	if err != nil {
+		return nil, err
+	}
+
+	coll := client.cards()
+
+	var sortStage bson.D
+	switch sortby {
+	case "value":
+		sortStage = bson.D{{client.sortField(false), 1}}
+	case "number":
+		sortStage = bson.D{{"collectornumber", 1}}
+	case "name":
+		sortStage = bson.D{{"name", 1}}
+	case "added":
+		sortStage = bson.D{{"serra_created", 1}}
+	default:
+		sortStage = bson.D{{"name", 1}}
+	}
+
+	cards, err := coll.storageFind(filter, sortStage, skip, limit)
+	if err != nil {
+		return nil, err
+	}
 
 	// This is needed because collectornumbers are strings (ie. "23a") but still we
 	// want it to be sorted numerically ... 1,2,3,10,11,100.
@@ -148,53 +357,51 @@ func Cards(rarity, set, sortby, name, oracle, cardType string, reserved, foil bo
 		})
 	}
 
-	// filter out cards that do not reach the minimum amount (--min-count)
-	// this is done after query result because find query constructed does not support
-	// aggregating fields (of count and countFoil).
-	temp := cards[:0]
-	for _, card := range cards {
-		if (card.SerraCount + card.SerraCountFoil) >= count {
-			temp = append(temp, card)
-		}
-	}
-	cards = temp
-
-	return cards
+	return cards, nil
 }
 
-func showCardList(cards []Card, detail bool) {
+func showCardList(v valuation, cards []Card, detail bool) {
 
 	var total float64
+	var unpriced int64
 	if detail {
 		for _, card := range cards {
-			fmt.Printf("* %dx %s%s%s (%s/%s) %s%.2f%s %s %s %s\n", card.SerraCount+card.SerraCountFoil+card.SerraCountEtched, Purple, card.Name, Reset, card.Set, card.CollectorNumber, Yellow, card.getValue(false), getCurrency(), Background, strings.Replace(card.ScryfallURI, "?utm_source=api", "", 1), Reset)
-			total = total + card.getValue(false)*float64(card.SerraCount) + card.getValue(true)*float64(card.SerraCountFoil)
+			fmt.Printf("* %dx %s%s%s (%s/%s) %s%.2f%s %s %s %s\n", card.SerraCount+card.SerraCountFoil+card.SerraCountEtched, Purple, card.Name, Reset, card.Set, card.CollectorNumber, Yellow, v.cardValue(card, false), v.symbol(), Background, strings.Replace(card.ScryfallURI, "?utm_source=api", "", 1), Reset)
+			total = total + v.cardValue(card, false)*float64(card.SerraCount) + v.cardValue(card, true)*float64(card.SerraCountFoil)
+			unpriced += v.unpriced(card)
 		}
 	} else {
 		for _, card := range cards {
-			fmt.Printf("* %dx %s%s%s (%s/%s) %s%.2f%s%s\n", card.SerraCount+card.SerraCountFoil+card.SerraCountEtched, Purple, card.Name, Reset, card.Set, card.CollectorNumber, Yellow, card.getValue(false), getCurrency(), Reset)
-			total = total + card.getValue(false)*float64(card.SerraCount) + card.getValue(true)*float64(card.SerraCountFoil)
+			fmt.Printf("* %dx %s%s%s (%s/%s) %s%.2f%s%s\n", card.SerraCount+card.SerraCountFoil+card.SerraCountEtched, Purple, card.Name, Reset, card.Set, card.CollectorNumber, Yellow, v.cardValue(card, false), v.symbol(), Reset)
+			total = total + v.cardValue(card, false)*float64(card.SerraCount) + v.cardValue(card, true)*float64(card.SerraCountFoil)
+			unpriced += v.unpriced(card)
 		}
 	}
 
-	fmt.Printf("\nTotal Value: %s%.2f%s%s\n", Yellow, total, getCurrency(), Reset)
+	fmt.Printf("\nTotal Value: %s%.2f%s%s\n", Yellow, total, v.symbol(), Reset)
+	if unpriced > 0 {
+		fmt.Printf("Unpriced: %s%d%s cards\n", Yellow, unpriced, Reset)
+	}
 
 }
 
-func showCardDetails(card *Card) error {
+func showCardDetails(v valuation, card *Card) error {
 	fmt.Printf("%s%s%s (%s/%s)\n", Purple, card.Name, Reset, card.Set, card.CollectorNumber)
 	fmt.Printf("Added: %s\n", stringToTime(card.SerraCreated))
 	fmt.Printf("Rarity: %s\n", card.Rarity)
 	fmt.Printf("Scryfall: %s\n", strings.Replace(card.ScryfallURI, "?utm_source=api", "", 1))
 
 	fmt.Printf("\n%sCurrent Value%s\n", Green, Reset)
-	fmt.Printf("* Normal: %dx %s%.2f%s%s\n", card.SerraCount, Yellow, card.getValue(false), getCurrency(), Reset)
+	fmt.Printf("* Normal: %dx %s%.2f%s%s\n", card.SerraCount, Yellow, v.cardValue(*card, false), v.symbol(), Reset)
 	if card.SerraCountFoil > 0 {
-		fmt.Printf("* Foil: %dx %s%.2f%s%s\n", card.SerraCountFoil, Yellow, card.getValue(true), getCurrency(), Reset)
+		fmt.Printf("* Foil: %dx %s%.2f%s%s\n", card.SerraCountFoil, Yellow, v.cardValue(*card, true), v.symbol(), Reset)
+	}
+	if unpriced := v.unpriced(*card); unpriced > 0 {
+		fmt.Printf("* Unpriced: %dx\n", unpriced)
 	}
 
 	fmt.Printf("\n%sValue History%s\n", Green, Reset)
-	showPriceHistory(card.SerraPrices, "* ", false)
+	showPriceHistory(v, v.history(*card), "* ", false)
 	fmt.Println()
 	return nil
 }
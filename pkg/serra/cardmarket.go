@@ -0,0 +1,50 @@
+package serra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CardmarketPriceGuide provides the trend prices of a Cardmarket price guide
+// export, identified by the Cardmarket id of the card
+type CardmarketPriceGuide struct {
+	prices map[int64]PriceEntry
+}
+
+// ReadCardmarketPriceGuide reads a price guide like
+//
+//	{"version": 1, "priceGuides": [{"idProduct": 1, "trend": 0.5, "trend-foil": 1.2}]}
+func ReadCardmarketPriceGuide(r io.Reader) (*CardmarketPriceGuide, error) {
+	var guide struct {
+		PriceGuides []struct {
+			IDProduct int64   `json:"idProduct"`
+			Trend     float64 `json:"trend"`
+			TrendFoil float64 `json:"trend-foil"`
+		} `json:"priceGuides"`
+	}
+	if err := json.NewDecoder(r).Decode(&guide); err != nil {
+		return nil, fmt.Errorf("Could not read Cardmarket price guide: %w", err)
+	}
+
+	c := &CardmarketPriceGuide{prices: map[int64]PriceEntry{}}
+	for _, p := range guide.PriceGuides {
+		c.prices[p.IDProduct] = PriceEntry{Eur: p.Trend, EurFoil: p.TrendFoil}
+	}
+	return c, nil
+}
+
+func (c *CardmarketPriceGuide) Name() string {
+	return "cardmarket"
+}
+
+func (c *CardmarketPriceGuide) Prices(card *Card) (*PriceEntry, error) {
+	if card.CardmarketID == 0 {
+		return nil, nil
+	}
+	p, ok := c.prices[int64(card.CardmarketID)]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
@@ -21,21 +21,74 @@ var checkCmd = &cobra.Command{
 	Long:          "Check if a card is in your collection. Useful for list comparsions",
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, cards []string) error {
-		checkCards(cards, detail)
-		return nil
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		results := client.checkCards(cards, detail)
+		return render(results, func() { showCheckResults(results) })
 	},
 }
 
-func checkCards(cards []string, detail bool) error {
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
-	defer storageDisconnect(client)
+// Status of a checked card
+const (
+	CheckPresent = "PRESENT"
+	CheckMissing = "MISSING"
+)
+
+// CheckResult tells if a single card is in the collection
+type CheckResult struct {
+	Card        string  `json:"card" yaml:"card"`
+	Status      string  `json:"status" yaml:"status"`
+	Name        string  `json:"name,omitempty" yaml:"name,omitempty"`
+	Rarity      string  `json:"rarity,omitempty" yaml:"rarity,omitempty"`
+	Value       float64 `json:"value,omitempty" yaml:"value,omitempty"`
+	Currency    string  `json:"currency,omitempty" yaml:"currency,omitempty"`
+	ScryfallURI string  `json:"scryfall_uri,omitempty" yaml:"scryfall_uri,omitempty"`
+}
+
+// CheckResults is a list of checked cards that can be written as csv
+type CheckResults []CheckResult
+
+func (l CheckResults) Header() []string {
+	return []string{"card", "status", "name", "rarity", "value", "currency", "scryfall_uri"}
+}
+
+func (l CheckResults) Rows() [][]string {
+	rows := [][]string{}
+	for _, r := range l {
+		rows = append(rows, []string{r.Card, r.Status, r.Name, r.Rarity, formatFloat(r.Value), r.Currency, r.ScryfallURI})
+	}
+	return rows
+}
+
+func newCheckResult(v valuation, card, status string, c *Card) CheckResult {
+	return CheckResult{
+		Card:        card,
+		Status:      status,
+		Name:        c.Name,
+		Rarity:      c.Rarity,
+		Value:       v.cardValue(*c, foil),
+		Currency:    v.currency,
+		ScryfallURI: strings.Replace(c.ScryfallURI, "?utm_source=api", "", 1),
+	}
+}
+
+func (client *Client) checkCards(cards []string, detail bool) CheckResults {
+	coll := client.cards()
 	l := Logger()
 
+	results := CheckResults{}
+
+	// cards given by name are looked up in the collection first
+	cards = client.resolveCards(cards, set, lookupLocal|lookupScryfall)
+
 	// Loop over different cards
 	for _, card := range cards {
 
-		if !strings.Contains(card, "/") {
+		if !isCardID(card) {
 			l.Errorf("Invalid card format %s. Needs to be set/collector number i.e. \"usg/13\"", card)
 			continue
 		}
@@ -56,22 +109,35 @@ func checkCards(cards []string, detail bool) error {
 			continue
 		}
 
-		// If Card is in collection, print yes.
 		if len(co) >= 1 {
-			c := co[0]
-			fmt.Printf("PRESENT %s \"%s\" (%s, %.2f%s) %s\n", card, c.Name, c.Rarity, c.getValue(foil), getCurrency(), strings.Replace(c.ScryfallURI, "?utm_source=api", "", 1))
+			results = append(results, newCheckResult(client.valuation(), card, CheckPresent, &co[0]))
 			continue
-		} else {
-			if detail {
-				// fetch card from scyrfall if --detail was given
-				c, _ := fetchCard(setName, collectorNumber)
-				fmt.Printf("MISSING %s \"%s\" (%s, %.2f%s) %s\n", card, c.Name, c.Rarity, c.getValue(foil), getCurrency(), strings.Replace(c.ScryfallURI, "?utm_source=api", "", 1))
-			} else {
-				// Just print, the card name was not found
-				fmt.Printf("MISSING \"%s\"\n", card)
+		}
+
+		if detail {
+			// fetch card from scyrfall if --detail was given
+			c, err := client.scryfall.fetchCard(setName, collectorNumber)
+			if err != nil {
+				l.Warn(err)
+				results = append(results, CheckResult{Card: card, Status: CheckMissing})
+				continue
 			}
+			results = append(results, newCheckResult(client.valuation(), card, CheckMissing, c))
+		} else {
+			// Just remember, the card name was not found
+			results = append(results, CheckResult{Card: card, Status: CheckMissing})
+		}
+	}
+	return results
+}
+
+func showCheckResults(results CheckResults) {
+	for _, r := range results {
+		// Just print, the card name was not found
+		if r.Name == "" {
+			fmt.Printf("%s \"%s\"\n", r.Status, r.Card)
+			continue
 		}
+		fmt.Printf("%s %s \"%s\" (%s, %.2f%s) %s\n", r.Status, r.Card, r.Name, r.Rarity, r.Value, currencySymbol(r.Currency), r.ScryfallURI)
 	}
-	storageDisconnect(client)
-	return nil
 }
@@ -0,0 +1,415 @@
+package serra
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Client gives access to a collection of cards. The commands of serra are
+// built on it, other tools can use it to embed serra as a library.
+//
+//	client, err := serra.NewClient(serra.WithStorageURI("mongodb://localhost:27017"))
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	client.AddCard("usg", "13", 1, serra.FinishFoil)
+type Client struct {
+	storage  *mongo.Client
+	uri      string
+	database string
+	name     string
+	scryfall *Scryfall
+	currency string
+	rates    RateTable
+	policy   PricePolicy
+
+	// price providers updated besides scryfall, and the one values are
+	// calculated by
+	providers []PriceProvider
+	provider  string
+
+	// storage was connected by the client and is disconnected on Close
+	connected bool
+
+	// the valuation is not checked against the stored rates
+	uncheckedValuation bool
+
+	// session context of a running transaction, if any
+	tx mongo.SessionContext
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithStorage uses an already connected storage client. It is not
+// disconnected on Close.
+func WithStorage(storage *mongo.Client) Option {
+	return func(c *Client) {
+		c.storage = storage
+	}
+}
+
+// WithStorageURI connects to the storage at uri, like
+// "mongodb://localhost:27017"
+func WithStorageURI(uri string) Option {
+	return func(c *Client) {
+		c.uri = uri
+	}
+}
+
+// WithDatabase uses another database than "serra"
+func WithDatabase(name string) Option {
+	return func(c *Client) {
+		c.database = name
+	}
+}
+
+// WithCollection uses a named collection of cards, i.e. of one member of a
+// household sharing the database
+func WithCollection(name string) Option {
+	return func(c *Client) {
+		c.name = name
+	}
+}
+
+// WithScryfall uses another scryfall client, for example with a custom http
+// client or base url
+func WithScryfall(scryfall *Scryfall) Option {
+	return func(c *Client) {
+		c.scryfall = scryfall
+	}
+}
+
+// WithCurrency calculates values in the given currency. Other currencies
+// than USD and EUR need imported exchange rates.
+func WithCurrency(currency string) Option {
+	return func(c *Client) {
+		c.currency = currency
+	}
+}
+
+// WithPricePolicy decides how cards without a price of the preferred source
+// are valued
+func WithPricePolicy(policy PricePolicy) Option {
+	return func(c *Client) {
+		c.policy = policy
+	}
+}
+
+// WithPriceProviders updates the prices of the providers along with the
+// scryfall prices
+func WithPriceProviders(providers ...PriceProvider) Option {
+	return func(c *Client) {
+		c.providers = append(c.providers, providers...)
+	}
+}
+
+// WithValuationSource calculates values by the prices of a provider instead
+// of scryfall. Its prices need to be updated before.
+func WithValuationSource(provider string) Option {
+	return func(c *Client) {
+		c.provider = provider
+	}
+}
+
+// WithoutValuationCheck skips checking that values can be calculated in the
+// currency, for example to import the exchange rates it needs.
+func WithoutValuationCheck() Option {
+	return func(c *Client) {
+		c.uncheckedValuation = true
+	}
+}
+
+// NewClient creates a client and connects to the storage
+func NewClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		database: "serra",
+		scryfall: NewScryfall(),
+		currency: "USD",
+		policy:   DefaultPricePolicy(),
+		provider: ScryfallProvider,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.name == "" {
+		c.name = DefaultCollection
+	}
+	if !collectionName.MatchString(c.name) {
+		return nil, fmt.Errorf("Invalid collection name %q, use lowercase letters, digits, - and _", c.name)
+	}
+
+	if !currencyCode.MatchString(c.currency) {
+		return nil, fmt.Errorf("Invalid currency %q, use an ISO code like USD, EUR or GBP", c.currency)
+	}
+	if err := c.policy.validate(); err != nil {
+		return nil, err
+	}
+	if !providerName.MatchString(c.provider) {
+		return nil, fmt.Errorf("Invalid valuation source %q, use the name of a price provider", c.provider)
+	}
+	if err := checkProviders(c.providers); err != nil {
+		return nil, err
+	}
+
+	if c.storage == nil {
+		if c.uri == "" {
+			return nil, fmt.Errorf("No storage configured, use WithStorage or WithStorageURI")
+		}
+		storage, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(c.uri))
+		if err != nil {
+			return nil, &StorageError{"connect to storage", err}
+		}
+		c.storage, c.connected = storage, true
+	}
+
+	rates, err := c.ratesCollection().storageFindRates()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.rates = rates
+
+	if !c.uncheckedValuation {
+		if err := c.valuation().check(); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// newClient creates a client with the settings of the profile in use and
+// the given options
+func newClient(opts ...Option) (*Client, error) {
+	if settings.StorageURI == "" {
+		return nil, fmt.Errorf("No storage configured. Use \"serra config set storage_uri <uri>\" or set MONGODB_URI")
+	}
+	client, err := NewClient(append([]Option{
+		WithStorageURI(settings.StorageURI),
+		WithDatabase(settings.Database),
+		WithCollection(settings.Collection),
+		WithCurrency(settings.Currency),
+		WithPricePolicy(settings.pricePolicy()),
+		WithValuationSource(settings.ValuationSource),
+		WithScryfall(&Scryfall{HTTP: http.DefaultClient, BaseURL: settings.ScryfallURL}),
+	}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Close disconnects from the storage
+func (client *Client) Close() error {
+	if !client.connected {
+		return nil
+	}
+	return client.storage.Disconnect(context.TODO())
+}
+
+// Currency returns the ISO code of the currency values are calculated in
+func (client *Client) Currency() string {
+	return client.currency
+}
+
+// Collection returns the name of the collection of cards the client uses
+func (client *Client) Collection() string {
+	return client.name
+}
+
+// Name of the collection used if none is given. Its cards are stored
+// without prefix, like before collections could be named.
+const DefaultCollection = "default"
+
+var collectionName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// collection returns the storage collection of a kind (cards, sets or
+// total) of the collection of the client, like "alice.cards"
+func (client *Client) collection(kind string) *Collection {
+	if client.name != DefaultCollection {
+		kind = client.name + "." + kind
+	}
+	return &Collection{Collection: client.storage.Database(client.database).Collection(kind), tx: client.tx}
+}
+
+// ratesCollection returns the exchange rates, which are shared by all
+// collections of the database
+func (client *Client) ratesCollection() *Collection {
+	return &Collection{Collection: client.storage.Database(client.database).Collection("rates"), tx: client.tx}
+}
+
+// withCollection returns a client using another collection of the database
+func (client *Client) withCollection(name string) *Client {
+	other := *client
+	other.name = name
+	return &other
+}
+
+// Collections returns the names of all collections in the database
+func (client *Client) Collections() ([]string, error) {
+	names, err := client.storage.Database(client.database).ListCollectionNames(context.TODO(), bson.D{{"name", bson.D{{"$regex", `(^|\.)cards$`}}}})
+	if err != nil {
+		return nil, &StorageError{"list collections", err}
+	}
+
+	collections := []string{}
+	for _, n := range names {
+		name := strings.TrimSuffix(strings.TrimSuffix(n, "cards"), ".")
+		if name == "" {
+			name = DefaultCollection
+		}
+		if collectionName.MatchString(name) {
+			collections = append(collections, name)
+		}
+	}
+	sort.Strings(collections)
+	return collections, nil
+}
+
+func (client *Client) cards() *Collection {
+	return client.collection("cards")
+}
+
+func (client *Client) sets() *Collection {
+	return client.collection("sets")
+}
+
+func (client *Client) totals() *Collection {
+	return client.collection("total")
+}
+
+// transaction runs fn within a multi-document transaction. All storage calls
+// of the client given to fn take part in it.
+func (client *Client) transaction(fn func(tx *Client) error) error {
+	return storageTransaction(client.storage, func(ctx mongo.SessionContext) error {
+		tx := *client
+		tx.tx = ctx
+		return fn(&tx)
+	})
+}
+
+// CardQuery searches cards of the collection
+type CardQuery struct {
+	CardFilter
+	Sort  string // value, number, name or added
+	Skip  int64
+	Limit int64
+}
+
+// GainsQuery selects the cards and sets whose value changed most
+type GainsQuery struct {
+	Window string  // update, added or a duration or date like 30d or 2024-01-01
+	Sort   string  // percent or value
+	Finish string  // all, normal or foil
+	Limit  float64 // minimum price to be taken into account
+	Losses bool    // cards and sets that lost value instead of gained
+}
+
+// AddCard adds an amount of a card in a finish. Cards not in the collection
+// yet are fetched from scryfall.
+func (client *Client) AddCard(set, collectorNumber string, count int64, finish string) (*CardChange, error) {
+	if err := checkCount(count); err != nil {
+		return nil, err
+	}
+	return client.addCard(set, collectorNumber, false, count, finish, nil)
+}
+
+// RemoveCard removes an amount of a card in a finish. The card is removed
+// completely, once no copy is left.
+func (client *Client) RemoveCard(set, collectorNumber string, count int64, finish string) (*CardChange, error) {
+	if err := checkCount(count); err != nil {
+		return nil, err
+	}
+	return client.removeCard(set, collectorNumber, count, finish, nil)
+}
+
+// FindCards returns the cards matching the query
+func (client *Client) FindCards(q CardQuery) ([]Card, error) {
+	return client.findCards(q.CardFilter, q.Sort, q.Skip, q.Limit)
+}
+
+// Sets returns all sets of the collection, sorted by release or value
+func (client *Client) Sets(sort string) (SetSummaries, error) {
+	sets, err := client.aggregateSets(sort)
+	if err != nil {
+		return nil, err
+	}
+	return client.setSummaries(sets)
+}
+
+// Stats calculates statistics of the collection
+func (client *Client) Stats() (*CollectionStats, error) {
+	return client.stats()
+}
+
+// Gains returns the cards and sets whose value changed most, and the ones
+// that could not be valued
+func (client *Client) Gains(q GainsQuery) (*GainsOutput, error) {
+	sort := -1
+	if q.Losses {
+		sort = 1
+	}
+	return client.gains(q.Window, q.Sort, q.Finish, q.Limit, sort)
+}
+
+// Update fetches the current prices and legalities of all cards and updates
+// the value of sets and of the whole collection
+func (client *Client) Update() (*UpdateResult, error) {
+	return client.update(newScryfallCache(client.scryfall), nil)
+}
+
+func (client *Client) valuation() valuation {
+	return valuation{client.currency, client.rates, client.policy, client.provider}
+}
+
+// cardValue returns the value of a single nonfoil or foil card in the
+// currency of the client
+func (client *Client) cardValue(c Card, foil bool) float64 {
+	return client.valuation().cardValue(c, foil)
+}
+
+// currencySymbol returns the human readable name of the currency of the
+// client
+func (client *Client) currencySymbol() string {
+	return client.valuation().symbol()
+}
+
+// priceField returns the price of a card in the currency of the client as
+// storage expression, converted with the latest rates
+func (client *Client) priceField(foil bool) interface{} {
+	prices, _ := client.valuation().fields()
+	return client.valuation().expr("$"+prices, client.rates.latest(), foil)
+}
+
+// finishPriceField returns the price of a card in the given finish as
+// storage expression, converted with the latest rates
+func (client *Client) finishPriceField(finish string) interface{} {
+	prices, _ := client.valuation().fields()
+	return client.valuation().finishExpr("$"+prices, client.rates.latest(), finish)
+}
+
+// sortField returns the stored price field of the preferred source to sort
+// cards by value
+func (client *Client) sortField(foil bool) string {
+	prices, _ := client.valuation().fields()
+	field := prices + "." + client.valuation().source()
+	if foil {
+		field += "_foil"
+	}
+	return field
+}
@@ -0,0 +1,395 @@
+package serra
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Profile of the config file to use (default from config or \"default\")")
+	rootCmd.PersistentFlags().StringVar(&collection, "collection", "", "Named collection of cards to use (default from config or \"default\")")
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configSetCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change the configuration",
+	Long: `Shows and changes the configuration in ~/.config/serra/config.toml.
+The config file holds named profiles, select one with --profile or
+SERRA_PROFILE. Environment variables override the settings of the profile:
+
+  MONGODB_URI         storage_uri
+  SERRA_DATABASE      database
+  SERRA_COLLECTION    collection
+  SERRA_CURRENCY      currency
+  SERRA_SCRYFALL_URL  scryfall_url
+
+Cards are valued by the price of price_source (usd or eur, by default the
+one of the currency). Cards without that price fall back to the comma
+separated fallbacks of their finish, fallback_normal and fallback_foil:
+
+  convert  the price of the other source, converted into the currency
+  nonfoil  foils are valued like the nonfoil card (fallback_foil only)
+  none     cards stay unpriced
+
+valuation_source is the price provider values are calculated by, scryfall
+or one updated with "serra update --mtgjson" or "--cardmarket".
+
+Settings: ` + fmt.Sprint(configKeys),
+}
+
+var configShowCmd = &cobra.Command{
+	Use:           "show",
+	Short:         "Show the settings of the profile in use",
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := ConfigOutput{File: configPath(), Profile: profileName(config), Settings: map[string]string{}}
+		for _, key := range configKeys {
+			out.Settings[key] = settings.get(key)
+		}
+		// do not leak the storage password
+		if u, err := url.Parse(settings.StorageURI); err == nil {
+			out.Settings["storage_uri"] = u.Redacted()
+		}
+		return render(out, func() { showConfig(out) })
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:           "set <key> <value>",
+	Short:         "Change a setting of the profile in use",
+	Args:          cobra.ExactArgs(2),
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := profileName(config)
+		p := config.Profiles[name]
+		if err := p.set(args[0], args[1]); err != nil {
+			return err
+		}
+
+		if config.Profiles == nil {
+			config.Profiles = map[string]Profile{}
+		}
+		config.Profiles[name] = p
+		if err := config.save(configPath()); err != nil {
+			return err
+		}
+		fmt.Printf("%sSet %s of profile %s to %s%s\n", Green, args[0], name, args[1], Reset)
+		return nil
+	},
+}
+
+// Profile is a named set of settings in the config file. Empty settings
+// are taken from the defaults.
+type Profile struct {
+	StorageURI      string `toml:"storage_uri,omitempty"`
+	Database        string `toml:"database,omitempty"`
+	Collection      string `toml:"collection,omitempty"`
+	Currency        string `toml:"currency,omitempty"`
+	PriceSource     string `toml:"price_source,omitempty"`
+	FallbackNormal  string `toml:"fallback_normal,omitempty"`
+	FallbackFoil    string `toml:"fallback_foil,omitempty"`
+	ValuationSource string `toml:"valuation_source,omitempty"`
+	ExportFormat    string `toml:"export_format,omitempty"`
+	WebAddress      string `toml:"web_address,omitempty"`
+	WebPort         uint64 `toml:"web_port,omitempty"`
+	ScryfallURL     string `toml:"scryfall_url,omitempty"`
+}
+
+// Config is the content of the config file
+type Config struct {
+	// profile used if none is given with --profile or SERRA_PROFILE
+	Profile  string             `toml:"profile,omitempty"`
+	Profiles map[string]Profile `toml:"profiles,omitempty"`
+}
+
+// Keys of the settings of a profile, in the order they are shown
+var configKeys = []string{"storage_uri", "database", "collection", "currency", "price_source", "fallback_normal", "fallback_foil", "valuation_source", "export_format", "web_address", "web_port", "scryfall_url"}
+
+// Export formats
+var exportFormats = []string{"tcgpowertools", "tcghome", "moxfield", "json"}
+
+var (
+	// config is the loaded config file
+	config Config
+
+	// settings are the defaults, overridden by the profile in use and the
+	// environment
+	settings = defaultProfile()
+)
+
+func defaultProfile() Profile {
+	return Profile{
+		Database:        "serra",
+		Collection:      DefaultCollection,
+		Currency:        "USD",
+		FallbackNormal:  FallbackConvert,
+		FallbackFoil:    FallbackConvert,
+		ValuationSource: ScryfallProvider,
+		ExportFormat:    "tcgpowertools",
+		WebAddress:      "0.0.0.0",
+		WebPort:         8080,
+		ScryfallURL:     scryfallURL,
+	}
+}
+
+// merge overrides all settings that are set in o
+func (p *Profile) merge(o Profile) {
+	if o.StorageURI != "" {
+		p.StorageURI = o.StorageURI
+	}
+	if o.Database != "" {
+		p.Database = o.Database
+	}
+	if o.Collection != "" {
+		p.Collection = o.Collection
+	}
+	if o.Currency != "" {
+		p.Currency = o.Currency
+	}
+	if o.PriceSource != "" {
+		p.PriceSource = o.PriceSource
+	}
+	if o.FallbackNormal != "" {
+		p.FallbackNormal = o.FallbackNormal
+	}
+	if o.FallbackFoil != "" {
+		p.FallbackFoil = o.FallbackFoil
+	}
+	if o.ValuationSource != "" {
+		p.ValuationSource = o.ValuationSource
+	}
+	if o.ExportFormat != "" {
+		p.ExportFormat = o.ExportFormat
+	}
+	if o.WebAddress != "" {
+		p.WebAddress = o.WebAddress
+	}
+	if o.WebPort != 0 {
+		p.WebPort = o.WebPort
+	}
+	if o.ScryfallURL != "" {
+		p.ScryfallURL = o.ScryfallURL
+	}
+}
+
+func (p Profile) get(key string) string {
+	switch key {
+	case "storage_uri":
+		return p.StorageURI
+	case "database":
+		return p.Database
+	case "collection":
+		return p.Collection
+	case "currency":
+		return p.Currency
+	case "price_source":
+		return p.PriceSource
+	case "fallback_normal":
+		return p.FallbackNormal
+	case "fallback_foil":
+		return p.FallbackFoil
+	case "valuation_source":
+		return p.ValuationSource
+	case "export_format":
+		return p.ExportFormat
+	case "web_address":
+		return p.WebAddress
+	case "web_port":
+		return strconv.FormatUint(p.WebPort, 10)
+	case "scryfall_url":
+		return p.ScryfallURL
+	}
+	return ""
+}
+
+// set changes a setting after checking the value
+func (p *Profile) set(key, value string) error {
+	switch key {
+	case "storage_uri":
+		p.StorageURI = value
+	case "database":
+		p.Database = value
+	case "collection":
+		if !collectionName.MatchString(value) {
+			return fmt.Errorf("Invalid collection name %q, use lowercase letters, digits, - and _", value)
+		}
+		p.Collection = value
+	case "currency":
+		if !currencyCode.MatchString(value) {
+			return fmt.Errorf("Invalid currency %q, use an ISO code like USD, EUR or GBP", value)
+		}
+		p.Currency = value
+	case "price_source":
+		if err := (PricePolicy{Source: value}).validate(); err != nil {
+			return err
+		}
+		p.PriceSource = value
+	case "fallback_normal":
+		if err := (PricePolicy{Normal: parseFallbacks(value)}).validate(); err != nil {
+			return err
+		}
+		p.FallbackNormal = formatFallbacks(parseFallbacks(value))
+	case "fallback_foil":
+		if err := (PricePolicy{Foil: parseFallbacks(value)}).validate(); err != nil {
+			return err
+		}
+		p.FallbackFoil = formatFallbacks(parseFallbacks(value))
+	case "valuation_source":
+		if !providerName.MatchString(value) {
+			return fmt.Errorf("Invalid valuation source %q, use the name of a price provider like %s or cardmarket", value, ScryfallProvider)
+		}
+		p.ValuationSource = value
+	case "export_format":
+		if !slices.Contains(exportFormats, value) {
+			return fmt.Errorf("Unknown export format %q, use one of %v", value, exportFormats)
+		}
+		p.ExportFormat = value
+	case "web_address":
+		p.WebAddress = value
+	case "web_port":
+		port, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("Invalid port %q", value)
+		}
+		p.WebPort = port
+	case "scryfall_url":
+		if _, err := url.ParseRequestURI(value); err != nil {
+			return fmt.Errorf("Invalid url %q", value)
+		}
+		p.ScryfallURL = value
+	default:
+		return fmt.Errorf("Unknown setting %q, use one of %v", key, configKeys)
+	}
+	return nil
+}
+
+// pricePolicy returns the price policy of the settings
+func (p Profile) pricePolicy() PricePolicy {
+	return PricePolicy{
+		Source: p.PriceSource,
+		Normal: parseFallbacks(p.FallbackNormal),
+		Foil:   parseFallbacks(p.FallbackFoil),
+	}
+}
+
+// configPath returns the path of the config file, $SERRA_CONFIG or
+// ~/.config/serra/config.toml
+func configPath() string {
+	if path := os.Getenv("SERRA_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "serra", "config.toml")
+}
+
+// readConfig reads the config file. A missing file is an empty config.
+func readConfig(path string) (Config, error) {
+	c := Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := toml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("Could not read config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c Config) save(path string) error {
+	data, err := toml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// the storage uri may contain a password
+	return os.WriteFile(path, data, 0o600)
+}
+
+// profileName returns the profile to use, given by --profile, SERRA_PROFILE
+// or the config file
+func profileName(c Config) string {
+	for _, name := range []string{profile, os.Getenv("SERRA_PROFILE"), c.Profile} {
+		if name != "" {
+			return name
+		}
+	}
+	return "default"
+}
+
+// loadSettings reads the config file and applies the profile in use and the
+// environment to the settings. Profiles that do not exist yet are only
+// accepted by the config command, to be able to create them.
+func loadSettings(cmd *cobra.Command) error {
+	c, err := readConfig(configPath())
+	if err != nil {
+		return err
+	}
+	config = c
+
+	name := profileName(c)
+	p, ok := c.Profiles[name]
+	if !ok && name != "default" && cmd.Parent() != configCmd {
+		return fmt.Errorf("Profile %q not found in %s", name, configPath())
+	}
+	settings = defaultProfile()
+	settings.merge(p)
+
+	settings.merge(Profile{
+		StorageURI:  os.Getenv("MONGODB_URI"),
+		Database:    os.Getenv("SERRA_DATABASE"),
+		Collection:  os.Getenv("SERRA_COLLECTION"),
+		Currency:    os.Getenv("SERRA_CURRENCY"),
+		ScryfallURL: os.Getenv("SERRA_SCRYFALL_URL"),
+	})
+
+	// the collection is chosen per command more often than the rest
+	settings.merge(Profile{Collection: collection})
+	return nil
+}
+
+// ConfigOutput is the machine readable representation of the settings
+type ConfigOutput struct {
+	File     string            `json:"file" yaml:"file"`
+	Profile  string            `json:"profile" yaml:"profile"`
+	Settings map[string]string `json:"settings" yaml:"settings"`
+}
+
+func (c ConfigOutput) Header() []string {
+	return []string{"key", "value"}
+}
+
+func (c ConfigOutput) Rows() [][]string {
+	rows := [][]string{}
+	for _, key := range configKeys {
+		rows = append(rows, []string{key, c.Settings[key]})
+	}
+	return rows
+}
+
+func showConfig(c ConfigOutput) {
+	fmt.Printf("%sProfile %s%s (%s)\n", Green, c.Profile, Reset, c.File)
+	for _, key := range configKeys {
+		fmt.Printf("%s = %s%s%s\n", key, Yellow, c.Settings[key], Reset)
+	}
+}
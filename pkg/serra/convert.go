@@ -0,0 +1,165 @@
+package serra
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	convertCmd.Flags().Int64VarP(&count, "count", "c", 1, "Amount of cards to convert")
+	convertCmd.Flags().StringVar(&fromFinish, "from", FinishNormal, "Finish to convert from (normal/foil/etched)")
+	convertCmd.Flags().StringVar(&toFinish, "to", FinishFoil, "Finish to convert to (normal/foil/etched)")
+	convertCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Spin up interactive terminal")
+	convertCmd.Flags().StringVarP(&set, "set", "s", "", "Filter by set code (usg/mmq/vow)")
+	rootCmd.AddCommand(convertCmd)
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert the finish of cards in your collection",
+	Long: `Moves copies of a card in your collection from one finish to another,
+for example when a card was added as normal but is actually a foil. Cards are
+given as set/collector number (usg/13) or by name ("Lightning Bolt").`,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, cards []string) error {
+		if err := validateConvertFinishes(fromFinish, toFinish); err != nil {
+			return err
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if interactive {
+			return client.convertCardsInteractive(set, fromFinish, toFinish)
+		}
+		_, err = client.convertCards(cards, set, count, fromFinish, toFinish)
+		return err
+	},
+}
+
+// Finishes as named by scryfall in the list of available finishes
+var scryfallFinishes = map[string]string{
+	FinishNormal: "nonfoil",
+	FinishFoil:   FinishFoil,
+	FinishEtched: FinishEtched,
+}
+
+func validateConvertFinishes(from, to string) error {
+	for _, f := range []string{from, to} {
+		if _, ok := scryfallFinishes[f]; !ok {
+			return fmt.Errorf("Unknown finish %q, use %s, %s or %s", f, FinishNormal, FinishFoil, FinishEtched)
+		}
+	}
+	if from == to {
+		return fmt.Errorf("Options --from and --to need to be different finishes")
+	}
+	return nil
+}
+
+func (client *Client) convertCardsInteractive(set, from, to string) error {
+	if len(set) == 0 {
+		return fmt.Errorf("Option --set <set> must be given in interactive mode")
+	}
+
+	l := Logger()
+	l.Infof("Converting cards from %s to %s", from, to)
+
+	session, err := client.runPrompt(set, lookupLocal, func(rl *readline.Instance, cards []string, entry *PromptEntry) []CardChange {
+		changes, _ := client.convertCards(cards, set, entry.Count, from, to)
+		return changes
+	})
+	if err != nil {
+		return err
+	}
+
+	// a conversion is recorded as removal and addition, so only the value
+	// changes in sum
+	converted := int64(0)
+	for _, entry := range session.entries {
+		for _, c := range entry {
+			if c.Amount > 0 {
+				converted += c.Amount
+			}
+		}
+	}
+	_, value := session.summary(client.valuation())
+	fmt.Printf("\n%sConverted %d cards, value changed by %s%.2f%s%s in this session\n", Green, converted, Yellow, value, client.currencySymbol(), Reset)
+	return nil
+}
+
+// convertCards converts an amount of cards from one finish to another and
+// returns the changes, as removal of the old and addition of the new finish.
+// Cards given by name are looked up within set, if it is not empty.
+func (client *Client) convertCards(cards []string, set string, count int64, from, to string) ([]CardChange, error) {
+	l := Logger()
+
+	if err := checkCount(count); err != nil {
+		return nil, err
+	}
+
+	// cards given by name are looked up in the collection
+	cards = client.resolveCards(cards, set, lookupLocal)
+
+	changes := []CardChange{}
+	for _, card := range cards {
+		if !isCardID(card) {
+			l.Errorf("Invalid card format %s. Needs to be set/collector number i.e. \"usg/13\"", card)
+			continue
+		}
+
+		setName := strings.ToLower(strings.Split(card, "/")[0])
+		collectorNumber := strings.TrimLeft(strings.Split(card, "/")[1], "0")
+
+		c, err := client.convertCard(setName, collectorNumber, count, from, to)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		changes = append(changes,
+			CardChange{Card: *c, Finish: from, Amount: -count},
+			CardChange{Card: *c, Finish: to, Amount: count},
+		)
+	}
+	return changes, nil
+}
+
+// convertCard moves an amount of a card from one finish to another within a
+// single update of the stored card
+func (client *Client) convertCard(setName, collectorNumber string, count int64, from, to string) (*Card, error) {
+	l := Logger()
+	coll := client.cards()
+	v := client.valuation()
+
+	c, err := findCardByCollectorNumber(coll, setName, collectorNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Finishes) > 0 && !slices.Contains(c.Finishes, scryfallFinishes[to]) {
+		return nil, fmt.Errorf("\"%s\" (%s/%s) is not printed in %s", c.Name, c.Set, c.CollectorNumber, to)
+	}
+
+	// the filter guards against converting more copies than owned, even if
+	// the card was changed in the meantime
+	filter := bson.D{{"_id", c.ID}, {countField(from), bson.D{{"$gte", count}}}}
+	update := bson.D{{"$inc", bson.D{{countField(from), -count}, {countField(to), count}}}}
+
+	res, err := coll.UpdateOne(coll.ctx(), filter, update)
+	if err != nil {
+		return nil, &StorageError{"convert card", err}
+	}
+	if res.MatchedCount == 0 {
+		return nil, fmt.Errorf("Only %d %s \"%s\" in the collection", c.getCount(from), from, c.Name)
+	}
+
+	l.Infof("%dx \"%s\" (%s/%s) converted from %s (%.2f%s) to %s (%.2f%s)", count, c.Name, c.Set, c.CollectorNumber, from, v.cardFinishValue(*c, from), v.symbol(), to, v.cardFinishValue(*c, to), v.symbol())
+	return c, nil
+}
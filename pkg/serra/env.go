@@ -1,33 +1,20 @@
 package serra
 
-import (
-	"os"
-)
-
 const EUR = "€"
 const USD = "$"
 
-func getMongoDBURI() string {
-	l := Logger()
-	uri := os.Getenv("MONGODB_URI")
-	if uri == "" {
-		l.Fatal("You must set 'MONGODB_URI' environmental variable. See\n\t https://docs.mongodb.com/drivers/go/current/usage-examples/#environment-variable")
-	}
-
-	return uri
+// Symbols of common currencies, others are shown by their ISO code
+var currencySymbols = map[string]string{
+	"USD": USD,
+	"EUR": EUR,
+	"GBP": "£",
+	"JPY": "¥",
 }
 
-// Returns configured human readable name for
-// the configured currency of the user
-func getCurrency() string {
-	l := Logger()
-	switch os.Getenv("SERRA_CURRENCY") {
-	case "EUR":
-		return EUR
-	case "USD":
-		return USD
-	default:
-		l.Warn("You did not configure SERRA_CURRENCY. Assuming \"USD\"")
-		return "$"
+// Returns a human readable name of a currency
+func currencySymbol(code string) string {
+	if symbol, ok := currencySymbols[code]; ok {
+		return symbol
 	}
+	return " " + code
 }
@@ -12,8 +12,9 @@ import (
 
 func init() {
 	exportCmd.Flags().StringVarP(&set, "set", "e", "", "Filter by set code (usg/mmq/vow)")
-	exportCmd.Flags().StringVarP(&format, "format", "f", "tcgpowertools", "Choose format to export (tcgpowertools/json)")
-	exportCmd.Flags().Int64VarP(&count, "min-count", "c", 0, "Occource more than X in your collection")
+	exportCmd.Flags().StringVarP(&format, "format", "f", "tcgpowertools", "Choose format to export (tcgpowertools/tcghome/moxfield/json), default from config")
+	exportCmd.Flags().StringVarP(&query, "query", "q", "", "Scryfall like search query (t:creature c>=ug cmc<=3 usd>2)")
+	exportCmd.Flags().Int64VarP(&minCount, "min-count", "c", 0, "Occource more than X in your collection")
 	rootCmd.AddCommand(exportCmd)
 }
 
@@ -25,22 +26,24 @@ var exportCmd = &cobra.Command{
 		Supports multiple output formats depending on where you want to export your collection.`,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cardList := Cards(rarity, set, sortby, name, oracle, cardType, reserved, foil, 0, 0)
-
-		// filter out cards that do not reach the minimum amount (--min-count)
-		// this is done after query result because find query constructed does not support
-		// aggregating fields (of count and countFoil).
-		temp := cardList[:0]
-		for _, card := range cardList {
-			if (card.SerraCount + card.SerraCountFoil) >= count {
-				temp = append(temp, card)
-			}
+		if !cmd.Flags().Changed("format") {
+			format = settings.ExportFormat
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		cardList, err := client.findCards(newCardFilter(), sortby, 0, 0)
+		if err != nil {
+			return err
 		}
-		cardList = temp
 
 		switch format {
 		case "tcgpowertools":
-			exportTCGPowertools(cardList)
+			exportTCGPowertools(client.valuation(), cardList)
 		case "tcghome":
 			exportTCGHome(cardList)
 		case "moxfield":
@@ -52,7 +55,7 @@ var exportCmd = &cobra.Command{
 	},
 }
 
-func exportTCGPowertools(cards []Card) {
+func exportTCGPowertools(v valuation, cards []Card) {
 
 	// TCGPowertools.com Example
 	// idProduct,quantity,name,set,condition,language,isFoil,isPlayset,isSigned,isFirstEd,price,comment
@@ -61,7 +64,7 @@ func exportTCGPowertools(cards []Card) {
 
 	fmt.Println("quantity,cardmarketId,name,set,condition,language,isFoil,isPlayset,price,comment")
 	for _, card := range cards {
-		fmt.Printf("%d,%.0f,%s,%s,EX,German,false,false,%.2f,\n", card.SerraCount+card.SerraCountFoil, card.CardmarketID, card.Name, card.SetName, card.getValue(false))
+		fmt.Printf("%d,%.0f,%s,%s,EX,German,false,false,%.2f,\n", card.SerraCount+card.SerraCountFoil, card.CardmarketID, card.Name, card.SetName, v.cardValue(card, false))
 	}
 }
 
@@ -1,10 +1,17 @@
 package serra
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -14,9 +21,17 @@ func init() {
 	topsCmd.Flags().Float64VarP(&limit, "limit", "l", 0, "Minimum card price to be shown in analysis")
 	topsCmd.Flags().BoolVarP(&sinceLastUpdate, "since-last-update", "u", false, "Show gains since last update")
 	topsCmd.Flags().BoolVarP(&sinceBeginning, "since-beginning", "b", true, "Show gains since beginning of records")
+	topsCmd.Flags().StringVar(&since, "since", "", "Show gains since date (2024-01-01) or duration (7d/4w/6m/1y)")
+	topsCmd.Flags().StringVarP(&gainsSort, "sort", "s", GainsSortPercent, "How to sort gains (percent/value)")
+	topsCmd.Flags().StringVar(&finish, "finish", FinishAll, "Which owned finishes to evaluate (all/normal/foil/etched)")
+	topsCmd.Flags().BoolVarP(&weighted, "weighted", "w", false, "Rank by value change of your copies (same as --sort value)")
 	flopsCmd.Flags().Float64VarP(&limit, "limit", "l", 0, "Minimum card price to be shown in analysis")
 	flopsCmd.Flags().BoolVarP(&sinceLastUpdate, "since-last-update", "u", false, "Show losses since last update")
 	flopsCmd.Flags().BoolVarP(&sinceBeginning, "since-beginning", "b", true, "Show losses since beginning of records")
+	flopsCmd.Flags().StringVar(&since, "since", "", "Show losses since date (2024-01-01) or duration (7d/4w/6m/1y)")
+	flopsCmd.Flags().StringVarP(&gainsSort, "sort", "s", GainsSortPercent, "How to sort losses (percent/value)")
+	flopsCmd.Flags().StringVar(&finish, "finish", FinishAll, "Which owned finishes to evaluate (all/normal/foil/etched)")
+	flopsCmd.Flags().BoolVarP(&weighted, "weighted", "w", false, "Rank by value change of your copies (same as --sort value)")
 }
 
 var topsCmd = &cobra.Command{
@@ -25,8 +40,13 @@ var topsCmd = &cobra.Command{
 	Short:         "What cards gained most value",
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		Gains(limit, -1)
-		return nil
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		return client.reportGains(limit, -1)
 	},
 }
 
@@ -36,129 +56,112 @@ var flopsCmd = &cobra.Command{
 	Short:         "What cards lost most value",
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		Gains(limit, 1)
-		return nil
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		return client.reportGains(limit, 1)
 	},
 }
 
-func Gains(limit float64, sort int) error {
+// Windows to compare prices in for tops and flops. Besides these, any
+// duration or date accepted by parseSince can be used.
+const (
+	WindowLastUpdate = "update"
+	WindowWeek       = "7d"
+	WindowMonth      = "30d"
+	WindowQuarter    = "90d"
+	WindowAdded      = "added"
+)
+
+// Orders for tops and flops
+const (
+	GainsSortPercent = "percent"
+	GainsSortValue   = "value"
+)
+
+// Finishes of owned copies
+const (
+	FinishAll    = "all"
+	FinishNormal = "normal"
+	FinishFoil   = "foil"
+	FinishEtched = "etched"
+)
+
+// Gain is the value development of a single card or set. For cards, each
+// owned finish is a gain of its own.
+type Gain struct {
+	Name            string  `mapstructure:"name" json:"name" yaml:"name"`
+	Set             string  `mapstructure:"set" json:"set" yaml:"set"`
+	CollectorNumber string  `mapstructure:"collectornumber" json:"collector_number,omitempty" yaml:"collector_number,omitempty"`
+	Finish          string  `mapstructure:"finish" json:"finish,omitempty" yaml:"finish,omitempty"`
+	Count           float64 `mapstructure:"count" json:"count" yaml:"count"`
+	Old             float64 `mapstructure:"old" json:"old" yaml:"old"`
+	Current         float64 `mapstructure:"current" json:"current" yaml:"current"`
+	Rate            float64 `mapstructure:"rate" json:"rate" yaml:"rate"`
+	ValueChange     float64 `mapstructure:"value_change" json:"value_change" yaml:"value_change"`
+
+	// dates of the compared prices, to convert them with the rates of the day
+	OldDate     primitive.DateTime `mapstructure:"old_date" json:"-" yaml:"-"`
+	CurrentDate primitive.DateTime `mapstructure:"current_date" json:"-" yaml:"-"`
+}
+
+// GainsOutput is the machine readable result of tops and flops
+type GainsOutput struct {
+	Currency string `json:"currency" yaml:"currency"`
+	Cards    []Gain `json:"cards" yaml:"cards"`
+	Sets     []Gain `json:"sets" yaml:"sets"`
 
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
-	setcoll := &Collection{client.Database("serra").Collection("sets")}
-	defer storageDisconnect(client)
+	// cards and sets whose prices could not be valued in the currency
+	Unpriced []Gain `json:"unpriced" yaml:"unpriced"`
+}
+
+func (g GainsOutput) Header() []string {
+	return []string{"type", "name", "set", "collector_number", "finish", "count", "old", "current", "rate", "value_change", "currency"}
+}
 
-	var old int
-	if sinceBeginning {
-		old = 0
+func (g GainsOutput) Rows() [][]string {
+	rows := [][]string{}
+	for _, kind := range []struct {
+		name  string
+		gains []Gain
+	}{{"card", g.Cards}, {"set", g.Sets}, {"unpriced", g.Unpriced}} {
+		for _, e := range kind.gains {
+			rows = append(rows, []string{kind.name, e.Name, e.Set, e.CollectorNumber, e.Finish, fmt.Sprintf("%.0f", e.Count), formatFloat(e.Old), formatFloat(e.Current), formatFloat(e.Rate), formatFloat(e.ValueChange), g.Currency})
+		}
 	}
+	return rows
+}
+
+// reportGains shows the gains or losses selected by the command line flags
+func (client *Client) reportGains(limit float64, sort int) error {
+	l := Logger()
+
+	window := WindowAdded
 	if sinceLastUpdate {
-		old = -2
+		window = WindowLastUpdate
+	}
+	if since != "" {
+		window = since
 	}
 
-	currencyField := "$serra_prices.usd"
-	if getCurrency() == EUR {
-		currencyField = "$serra_prices.eur"
+	order := gainsSort
+	if weighted {
+		order = GainsSortValue
 	}
 
-	raisePipeline := mongo.Pipeline{
-		bson.D{{"$project",
-			bson.D{
-				{"name", true},
-				{"set", true},
-				{"collectornumber", true},
-				{"old",
-					bson.D{{"$arrayElemAt",
-						bson.A{currencyField, old},
-					}},
-				},
-				{"current",
-					bson.D{{"$arrayElemAt",
-						bson.A{currencyField, -1},
-					}},
-				},
-			},
-		}},
-		bson.D{{"$match",
-			bson.D{{"old", bson.D{{"$gt", limit}}}},
-		}},
-		bson.D{{"$project",
-			bson.D{
-				{"name", true},
-				{"set", true},
-				{"old", true},
-				{"current", true},
-				{"collectornumber", true},
-				{"rate",
-					bson.D{{"$subtract",
-						bson.A{
-							bson.D{{"$divide",
-								bson.A{"$current",
-									bson.D{{"$divide",
-										bson.A{"$old", 100},
-									}},
-								},
-							}},
-							100,
-						},
-					}},
-				},
-			},
-		}},
-		bson.D{{"$sort",
-			bson.D{{"rate", sort}}}},
-		bson.D{{"$limit", 20}},
-	}
-	raise, _ := coll.storageAggregate(raisePipeline)
+	gains, err := client.gains(window, order, finish, limit, sort)
+	if err != nil {
+		l.Error(err)
+		return err
+	}
 
-	sraisePipeline := mongo.Pipeline{
-		bson.D{{"$project",
-			bson.D{
-				{"name", true},
-				{"code", true},
-				{"old",
-					bson.D{{"$arrayElemAt",
-						bson.A{currencyField, old},
-					}},
-				},
-				{"current",
-					bson.D{{"$arrayElemAt",
-						bson.A{currencyField, -1},
-					}},
-				},
-			},
-		}},
-		bson.D{{"$match",
-			bson.D{{"old", bson.D{{"$gt", limit}}}},
-		}},
-		bson.D{{"$project",
-			bson.D{
-				{"name", true},
-				{"code", true},
-				{"old", true},
-				{"current", true},
-				{"rate",
-					bson.D{{"$subtract",
-						bson.A{
-							bson.D{{"$divide",
-								bson.A{"$current",
-									bson.D{{"$divide",
-										bson.A{"$old", 100},
-									}},
-								},
-							}},
-							100,
-						},
-					}},
-				},
-			},
-		}},
-		bson.D{{"$sort",
-			bson.D{{"rate", sort}}}},
-		bson.D{{"$limit", 10}},
-	}
-	sraise, _ := setcoll.storageAggregate(sraisePipeline)
+	return render(*gains, func() { showGains(client.valuation(), gains, sort) })
+}
 
+func showGains(v valuation, gains *GainsOutput, sort int) {
 	// percentage coloring
 	var pColor string
 	if sort == 1 {
@@ -169,14 +172,324 @@ func Gains(limit float64, sort int) error {
 
 	fmt.Printf("%sCards%s\n", Purple, Reset)
 	// print each card
-	for _, e := range raise {
-		fmt.Printf("%s%+.0f%%%s %s %s(%s/%s)%s (%.2f->%s%.2f%s%s) \n", pColor, e["rate"], Reset, e["name"], Yellow, e["set"], e["collectornumber"], Reset, e["old"], Green, e["current"], getCurrency(), Reset)
+	for _, e := range gains.Cards {
+		var finishLabel string
+		if e.Finish != FinishNormal {
+			finishLabel = ", " + e.Finish
+		}
+		fmt.Printf("%s%+.0f%%%s %s %s(%s/%s%s)%s (%.2f->%s%.2f%s%s) %.0fx %s%+.2f%s%s\n", pColor, e.Rate, Reset, e.Name, Yellow, e.Set, e.CollectorNumber, finishLabel, Reset, e.Old, Green, e.Current, v.symbol(), Reset, e.Count, pColor, e.ValueChange, v.symbol(), Reset)
 	}
 
 	fmt.Printf("\n%sSets%s\n", Purple, Reset)
-	for _, e := range sraise {
-		fmt.Printf("%s%+.0f%%%s %s %s(%s)%s (%.2f->%s%.2f%s%s) \n", pColor, e["rate"], Reset, e["name"], Yellow, e["code"], Reset, e["old"], Green, e["current"], getCurrency(), Reset)
+	for _, e := range gains.Sets {
+		fmt.Printf("%s%+.0f%%%s %s %s(%s)%s (%.2f->%s%.2f%s%s) %s%+.2f%s%s\n", pColor, e.Rate, Reset, e.Name, Yellow, e.Set, Reset, e.Old, Green, e.Current, v.symbol(), Reset, pColor, e.ValueChange, v.symbol(), Reset)
 	}
-	return nil
 
+	if len(gains.Unpriced) > 0 {
+		fmt.Printf("\n%sUnpriced%s\n", Purple, Reset)
+	}
+	for _, e := range gains.Unpriced {
+		if e.CollectorNumber == "" {
+			fmt.Printf("%s %s(%s)%s\n", e.Name, Yellow, e.Set, Reset)
+			continue
+		}
+		var finishLabel string
+		if e.Finish != FinishNormal {
+			finishLabel = ", " + e.Finish
+		}
+		fmt.Printf("%s %s(%s/%s%s)%s %.0fx\n", e.Name, Yellow, e.Set, e.CollectorNumber, finishLabel, Reset, e.Count)
+	}
+}
+
+// gains calculates cards and sets that gained (sort -1) or lost (sort 1)
+// most value since the given window, ordered by percent or by the absolute
+// change of the owned copies value. Every owned finish of a card is evaluated
+// with its own price. Cards and sets that cannot be valued in the currency are
+// listed as unpriced.
+func (client *Client) gains(window, order, finish string, limit float64, sort int) (*GainsOutput, error) {
+
+	oldPrice, err := gainsOldPrice(window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	sortField := "rate"
+	switch order {
+	case GainsSortPercent, "":
+	case GainsSortValue:
+		sortField = "value_change"
+	default:
+		return nil, fmt.Errorf("Unknown sort order %q, use %s or %s", order, GainsSortPercent, GainsSortValue)
+	}
+
+	var finishes []string
+	switch finish {
+	case FinishAll, "":
+		finishes = []string{FinishNormal, FinishFoil, FinishEtched}
+	case FinishNormal, FinishFoil, FinishEtched:
+		finishes = []string{finish}
+	default:
+		return nil, fmt.Errorf("Unknown finish %q, use %s, %s, %s or %s", finish, FinishAll, FinishNormal, FinishFoil, FinishEtched)
+	}
+
+	coll := client.cards()
+	setcoll := client.sets()
+
+	// cards are compared by the price history of the valuation source
+	v := client.valuation()
+	_, cardHistory := v.fields()
+	cardHistory = "$" + cardHistory
+
+	raisePipeline := mongo.Pipeline{
+		bson.D{{"$project", bson.D{
+			{"name", true},
+			{"set", true},
+			{"collectornumber", true},
+			{"serra_count", true},
+			{"serra_count_foil", true},
+			{"serra_count_etched", true},
+			{"old", oldPrice(cardHistory, "")},
+			{"current", bson.D{{"$arrayElemAt", bson.A{cardHistory, -1}}}},
+		}}},
+	}
+	raise, err := coll.storageAggregate(raisePipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	// set prices are the value of all owned cards already, valued with the
+	// price policy during update. The preferred source fields of each finish
+	// are summed up instead of evaluated separately. Etched copies are part
+	// of the foil value of sets.
+	setOld, setCurrent := bson.A{}, bson.A{}
+	setFields := []string{}
+	for _, f := range finishes {
+		field := v.source()
+		if f != FinishNormal {
+			field += "_foil"
+		}
+		if slices.Contains(setFields, field) {
+			continue
+		}
+		setFields = append(setFields, field)
+		setOld = append(setOld, bson.D{{"$ifNull", bson.A{oldPrice("$serra_prices", field), 0}}})
+		setCurrent = append(setCurrent, bson.D{{"$ifNull", bson.A{bson.D{{"$arrayElemAt", bson.A{"$serra_prices." + field, -1}}}, 0}}})
+	}
+
+	sraisePipeline := mongo.Pipeline{
+		bson.D{{"$project", bson.D{
+			{"name", true},
+			{"set", "$code"},
+			{"count", bson.D{{"$literal", 1}}},
+			{"old", bson.D{{"$add", setOld}}},
+			{"old_date", oldPrice("$serra_prices", "date")},
+			{"current", bson.D{{"$add", setCurrent}}},
+			{"current_date", bson.D{{"$arrayElemAt", bson.A{"$serra_prices.date", -1}}}},
+		}}},
+		bson.D{{"$match", bson.D{{"old", bson.D{{"$gt", 0}}}}}},
+	}
+	sraise, err := setcoll.storageAggregate(sraisePipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	cards, unpricedCards := valueGains(v, decodeGainCards(raise), finishes)
+	sets, unpricedSets := client.convertGains(decodeGains(sraise))
+	return &GainsOutput{
+		Currency: client.currency,
+		Cards:    rankGains(cards, sortField, limit, sort, 20),
+		Sets:     rankGains(sets, sortField, limit, sort, 10),
+		Unpriced: append(unpricedCards, unpricedSets...),
+	}, nil
+}
+
+// gainCard is an owned card with the price entries gains compares
+type gainCard struct {
+	Card    `bson:",inline"`
+	Old     PriceEntry `bson:"old"`
+	Current PriceEntry `bson:"current"`
+}
+
+// valueGains values the old and current price of each owned finish of cards
+// like any other card value, with the fallbacks of the price policy. Finishes
+// without price on either side are returned as unpriced.
+func valueGains(v valuation, cards []gainCard, finishes []string) (priced, unpriced []Gain) {
+	priced, unpriced = []Gain{}, []Gain{}
+	for _, c := range cards {
+		for _, f := range finishes {
+			count := c.getCount(f)
+			if count <= 0 {
+				continue
+			}
+			g := Gain{Name: c.Name, Set: c.Set, CollectorNumber: c.CollectorNumber, Finish: f, Count: float64(count)}
+			old, okOld := v.value(c.Old, f)
+			current, okCurrent := v.value(c.Current, f)
+			if !okOld || !okCurrent {
+				unpriced = append(unpriced, g)
+				continue
+			}
+			g.Old, g.Current = old, current
+			priced = append(priced, g)
+		}
+	}
+	return priced, unpriced
+}
+
+// rankGains calculates the rate and value change between the old and current
+// price of gains with an old price above limit and returns the top entries
+func rankGains(gains []Gain, sortField string, limit float64, sort int, size int) []Gain {
+	ranked := []Gain{}
+	for _, g := range gains {
+		if g.Old <= limit {
+			continue
+		}
+		g.Rate = g.Current/(g.Old/100) - 100
+		g.ValueChange = (g.Current - g.Old) * g.Count
+		ranked = append(ranked, g)
+	}
+
+	key := func(g Gain) float64 {
+		if sortField == "value_change" {
+			return g.ValueChange
+		}
+		return g.Rate
+	}
+	slices.SortStableFunc(ranked, func(a, b Gain) int {
+		return cmp.Compare(key(a), key(b)) * sort
+	})
+
+	if len(ranked) > size {
+		ranked = ranked[:size]
+	}
+	return ranked
+}
+
+// gainsOldPrice returns a function constructing the expression that selects
+// the price to compare with. For date based windows this is the price recorded
+// nearest to that date, so results do not depend on how often update ran.
+// history is the price history to select from, like "$serra_prices". An
+// empty field selects the whole price entry.
+func gainsOldPrice(window string, now time.Time) (func(history, field string) bson.D, error) {
+	switch window {
+	case WindowLastUpdate:
+		return func(history, field string) bson.D {
+			return bson.D{{"$arrayElemAt", bson.A{fieldPath(history, field), -2}}}
+		}, nil
+	case WindowAdded, "":
+		return func(history, field string) bson.D {
+			return bson.D{{"$arrayElemAt", bson.A{fieldPath(history, field), 0}}}
+		}, nil
+	}
+
+	date, err := parseSince(window, now)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := primitive.NewDateTimeFromTime(date)
+	distance := func(entry string) bson.D {
+		return bson.D{{"$abs", bson.D{{"$subtract", bson.A{entry + ".date", cutoff}}}}}
+	}
+
+	return func(history, field string) bson.D {
+		return bson.D{{"$let", bson.D{
+			{"vars", bson.D{
+				{"nearest", bson.D{{"$reduce", bson.D{
+					{"input", history},
+					{"initialValue", bson.D{{"$arrayElemAt", bson.A{history, 0}}}},
+					{"in", bson.D{{"$cond", bson.A{
+						bson.D{{"$lt", bson.A{distance("$$this"), distance("$$value")}}},
+						"$$this",
+						"$$value",
+					}}}},
+				}}}},
+			}},
+			{"in", fieldPath("$$nearest", field)},
+		}}}
+	}, nil
+}
+
+// fieldPath returns the path of a field of a document, or the document itself
+// for an empty field
+func fieldPath(doc, field string) string {
+	if field == "" {
+		return doc
+	}
+	return doc + "." + field
+}
+
+// parseSince parses a date (2024-01-01) or a duration relative to now in
+// days, weeks, months or years (7d, 4w, 6m, 1y)
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if date, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return date, nil
+	}
+
+	invalid := fmt.Errorf("Invalid since %q, use a date like 2024-01-01 or a duration like 7d, 4w, 6m or 1y", since)
+	if len(since) < 2 {
+		return time.Time{}, invalid
+	}
+
+	amount, err := strconv.Atoi(since[:len(since)-1])
+	if err != nil || amount < 0 {
+		return time.Time{}, invalid
+	}
+
+	switch strings.ToLower(since[len(since)-1:]) {
+	case "d":
+		return now.AddDate(0, 0, -amount), nil
+	case "w":
+		return now.AddDate(0, 0, -7*amount), nil
+	case "m":
+		return now.AddDate(0, -amount, 0), nil
+	case "y":
+		return now.AddDate(-amount, 0, 0), nil
+	}
+
+	return time.Time{}, invalid
+}
+
+// convertGains converts the set prices of gains from the preferred price
+// source into the currency, each with the rates of the day it was recorded. Gains
+// without rates for one of the days are returned as unpriced.
+func (client *Client) convertGains(gains []Gain) (converted, unpriced []Gain) {
+	from := sourceCurrency(client.valuation().source())
+	converted, unpriced = []Gain{}, []Gain{}
+	for _, g := range gains {
+		old, okOld := client.rates.at(g.OldDate).exchange(g.Old, from, client.currency)
+		current, okCurrent := client.rates.at(g.CurrentDate).exchange(g.Current, from, client.currency)
+		if !okOld || !okCurrent {
+			unpriced = append(unpriced, g)
+			continue
+		}
+		g.Old, g.Current = old, current
+		converted = append(converted, g)
+	}
+	return converted, unpriced
+}
+
+func decodeGainCards(results []primitive.M) []gainCard {
+	cards := []gainCard{}
+	for _, r := range results {
+		raw, err := bson.Marshal(r)
+		if err != nil {
+			continue
+		}
+		c := gainCard{}
+		if err := bson.Unmarshal(raw, &c); err != nil {
+			continue
+		}
+		cards = append(cards, c)
+	}
+	return cards
+}
+
+func decodeGains(results []primitive.M) []Gain {
+	gains := []Gain{}
+	for _, r := range results {
+		g := Gain{}
+		mapstructure.Decode(r, &g)
+		gains = append(gains, g)
+	}
+	return gains
 }
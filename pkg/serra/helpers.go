@@ -3,6 +3,7 @@ package serra
 import (
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"strconv"
@@ -12,10 +13,15 @@ import (
 	"github.com/charmbracelet/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Rarities struct {
-	Rares, Uncommons, Commons, Mythics float64
+	Rares     float64 `json:"rares" yaml:"rares"`
+	Uncommons float64 `json:"uncommons" yaml:"uncommons"`
+	Commons   float64 `json:"commons" yaml:"commons"`
+	Mythics   float64 `json:"mythics" yaml:"mythics"`
 }
 
 var (
@@ -34,57 +40,93 @@ var (
 	Yellow      = "\033[38;5;229m"
 )
 
+// logOutput is where Logger writes to. Full screen interfaces redirect it, so
+// log messages do not mess up the screen.
+var logOutput io.Writer = os.Stderr
+
 func Logger() *log.Logger {
 
-	l := log.New(os.Stderr)
+	l := log.New(logOutput)
 	l.SetReportTimestamp(false)
 	return l
 }
 
-func modifyCardCount(coll *Collection, c *Card, amount int64, foil bool) error {
-
-	// find already existing card
-	sort := bson.D{{"_id", 1}}
-	searchFilter := bson.D{{"_id", c.ID}}
-	l := Logger()
-	storedCards, err := coll.storageFind(searchFilter, sort, 0, 0)
-	if err != nil {
-		return err
+// Returns the storage field counting the cards of a finish
+func countField(finish string) string {
+	switch finish {
+	case FinishFoil:
+		return "serra_count_foil"
+	case FinishEtched:
+		return "serra_count_etched"
 	}
-	storedCard := storedCards[0]
+	return "serra_count"
+}
 
-	// update card amount
-	var update bson.M
+// Returns the finish of the --foil flag
+func foilFinish(foil bool) string {
 	if foil {
-		update = bson.M{
-			"$set": bson.M{"serra_count_foil": storedCard.SerraCountFoil + amount},
+		return FinishFoil
+	}
+	return FinishNormal
+}
+
+// modifyCardCount atomically changes the amount of a card in a finish. The
+// amount never drops below zero and the card is removed, once no copy of any
+// finish is left. Returns if the card was removed.
+func modifyCardCount(coll *Collection, v valuation, c *Card, amount int64, finish string) (bool, error) {
+	l := Logger()
+	field := countField(finish)
+
+	// the filter guards against removing more copies than owned, even if the
+	// card was changed in the meantime
+	filter := bson.D{{"_id", c.ID}}
+	if amount < 0 {
+		filter = append(filter, bson.E{field, bson.D{{"$gte", -amount}}})
+	}
+	update := bson.D{{"$inc", bson.D{{field, amount}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var storedCard Card
+	err := coll.FindOneAndUpdate(coll.ctx(), filter, update, opts).Decode(&storedCard)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		current, err := coll.storageFind(bson.D{{"_id", c.ID}}, bson.D{}, 0, 0)
+		if err != nil {
+			return false, err
 		}
-	} else {
-		update = bson.M{
-			"$set": bson.M{"serra_count": storedCard.SerraCount + amount},
+		if len(current) < 1 {
+			return false, fmt.Errorf("Card \"%s\" not found", c.Name)
 		}
+		return false, fmt.Errorf("Only %d %s \"%s\" in the collection", current[0].getCount(finish), finish, c.Name)
+	}
+	if err != nil {
+		return false, &StorageError{"update card count", err}
 	}
 
-	coll.storageUpdate(bson.M{"_id": bson.M{"$eq": c.ID}}, update)
+	total := storedCard.getCount(finish)
+	before := total - amount
 
-	var total int64
-	if foil {
-		total = storedCard.SerraCountFoil + amount
-		if amount < 0 {
-			l.Warnf("Reduced card amount of \"%s\" (%.2f%s, foil) from %d to %d", storedCard.Name, storedCard.getValue(true), getCurrency(), storedCard.SerraCountFoil, total)
-		} else {
-			l.Warnf("Increased card amount of \"%s\" (%.2f%s, foil) from %d to %d", storedCard.Name, storedCard.getValue(true), getCurrency(), storedCard.SerraCountFoil, total)
-		}
+	var suffix string
+	if finish != FinishNormal {
+		suffix = ", " + finish
+	}
+	if amount < 0 {
+		l.Warnf("Reduced card amount of \"%s\" (%.2f%s%s) from %d to %d", storedCard.Name, v.cardFinishValue(storedCard, finish), v.symbol(), suffix, before, total)
 	} else {
-		total = storedCard.SerraCount + amount
-		if amount < 0 {
-			l.Warnf("Reduced card amount of \"%s\" (%.2f%s) from %d to %d", storedCard.Name, storedCard.getValue(false), getCurrency(), storedCard.SerraCount, total)
-		} else {
-			l.Warnf("Increased card amount of \"%s\" (%.2f%s) from %d to %d", storedCard.Name, storedCard.getValue(false), getCurrency(), storedCard.SerraCount, total)
-		}
+		l.Warnf("Increased card amount of \"%s\" (%.2f%s%s) from %d to %d", storedCard.Name, v.cardFinishValue(storedCard, finish), v.symbol(), suffix, before, total)
 	}
 
-	return nil
+	if storedCard.SerraCount+storedCard.SerraCountFoil+storedCard.SerraCountEtched > 0 {
+		return false, nil
+	}
+
+	// remove the card, unless a copy was added in the meantime. Cards stored
+	// before etched finishes were tracked have no etched count at all.
+	none := bson.D{{"$in", bson.A{0, nil}}}
+	res, err := coll.DeleteOne(coll.ctx(), bson.D{{"_id", c.ID}, {"serra_count", none}, {"serra_count_foil", none}, {"serra_count_etched", none}})
+	if err != nil {
+		return false, &StorageError{"remove card", err}
+	}
+	return res.DeletedCount > 0, nil
 }
 
 func findCardByCollectorNumber(coll *Collection, setCode string, collectorNumber string) (*Card, error) {
@@ -125,6 +167,9 @@ func missing(a, b []string) []string {
 	return diffs
 }
 
+// errSetNotFound is returned for sets not known to the collection yet
+var errSetNotFound = errors.New("Set not found")
+
 func findSetByCode(coll *Collection, setcode string) (*Set, error) {
 	storedSets, err := coll.storageFindSet(bson.D{{"code", setcode}}, bson.D{{"_id", 1}})
 	if err != nil {
@@ -132,7 +177,7 @@ func findSetByCode(coll *Collection, setcode string) (*Set, error) {
 	}
 
 	if len(storedSets) < 1 {
-		return &Set{}, errors.New("Set not found")
+		return &Set{}, errSetNotFound
 	}
 
 	return &storedSets[0], nil
@@ -190,37 +235,45 @@ func convertRarities(rar []primitive.M) Rarities {
 
 }
 
-func showPriceHistory(prices []PriceEntry, prefix string, total bool) {
+func showPriceHistory(v valuation, prices []PriceEntry, prefix string, total bool) {
 
 	var before float64
 	for _, e := range prices {
 
-		var value float64
+		value := v.priceValue(e, false)
 		if total {
-			if getCurrency() == EUR {
-				value = e.Eur + e.EurFoil
-			} else {
-				value = e.Usd + e.UsdFoil
-			}
-		} else {
-			if getCurrency() == EUR {
-				value = e.Eur
-			} else {
-				value = e.Usd
-			}
+			value = value + v.priceValue(e, true)
 		}
 
 		if value > before && before != 0 {
-			fmt.Printf("%s%s%s %.2f%s%s (%+.2f%%, %+.2f%s)\n", prefix, stringToTime(e.Date), Green, value, getCurrency(), Reset, (value/before*100)-100, value-before, getCurrency())
+			fmt.Printf("%s%s%s %.2f%s%s (%+.2f%%, %+.2f%s)\n", prefix, stringToTime(e.Date), Green, value, v.symbol(), Reset, (value/before*100)-100, value-before, v.symbol())
 		} else if value < before {
-			fmt.Printf("%s%s%s %.2f%s%s (%+.2f%%, %+.2f%s)\n", prefix, stringToTime(e.Date), Red, value, getCurrency(), Reset, (value/before*100)-100, value-before, getCurrency())
+			fmt.Printf("%s%s%s %.2f%s%s (%+.2f%%, %+.2f%s)\n", prefix, stringToTime(e.Date), Red, value, v.symbol(), Reset, (value/before*100)-100, value-before, v.symbol())
 		} else {
-			fmt.Printf("%s%s %.2f%s%s\n", prefix, stringToTime(e.Date), value, getCurrency(), Reset)
+			fmt.Printf("%s%s %.2f%s%s\n", prefix, stringToTime(e.Date), value, v.symbol(), Reset)
 		}
 		before = value
 	}
 }
 
+// PriceChart holds a price history split into chart friendly series
+type PriceChart struct {
+	Labels []string
+	Normal []float64
+	Foil   []float64
+}
+
+// priceHistoryChart converts a price history into series for the web ui
+func priceHistoryChart(v valuation, prices []PriceEntry) PriceChart {
+	chart := PriceChart{Labels: []string{}, Normal: []float64{}, Foil: []float64{}}
+	for _, e := range prices {
+		chart.Labels = append(chart.Labels, stringToTime(e.Date))
+		chart.Normal = append(chart.Normal, v.priceValue(e, false))
+		chart.Foil = append(chart.Foil, v.priceValue(e, true))
+	}
+	return chart
+}
+
 func filterForDigits(str string) int {
 	var numStr string
 	for _, c := range str {
@@ -0,0 +1,136 @@
+package serra
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// HouseholdMember is the summary of a single collection of the household
+type HouseholdMember struct {
+	Collection string
+	Count      float64
+	Unique     float64
+	Value      float64
+}
+
+// HouseholdCard is a card and the collection it belongs to
+type HouseholdCard struct {
+	Collection string
+	Card       Card
+}
+
+// Household combines all collections of the database
+type Household struct {
+	Members      []HouseholdMember
+	MostValuable []HouseholdCard
+
+	// cards owned in more than one collection
+	Shared int
+}
+
+// Returns the amount of cards of all collections
+func (h Household) Count() float64 {
+	var count float64
+	for _, m := range h.Members {
+		count += m.Count
+	}
+	return count
+}
+
+// Returns the value of all collections
+func (h Household) Value() float64 {
+	var value float64
+	for _, m := range h.Members {
+		value += m.Value
+	}
+	return value
+}
+
+// household summarizes all collections of the database and finds their
+// most valuable cards
+func (client *Client) household() (*Household, error) {
+	names, err := client.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Household{Members: []HouseholdMember{}, MostValuable: []HouseholdCard{}}
+	owners := map[string]int{}
+	for _, name := range names {
+		c := client.withCollection(name)
+
+		member, err := c.householdMember()
+		if err != nil {
+			return nil, err
+		}
+		h.Members = append(h.Members, *member)
+
+		cards, err := c.cards().storageFind(bson.D{}, bson.D{{c.sortField(false), -1}}, 0, 10)
+		if err != nil {
+			return nil, err
+		}
+		for _, card := range cards {
+			h.MostValuable = append(h.MostValuable, HouseholdCard{name, card})
+		}
+
+		keys, err := c.cards().storageAggregate(mongo.Pipeline{
+			bson.D{{"$project", bson.D{{"_id", false}, {"set", true}, {"collectornumber", true}}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			set, _ := k["set"].(string)
+			number, _ := k["collectornumber"].(string)
+			owners[set+"/"+number]++
+		}
+	}
+
+	sort.SliceStable(h.MostValuable, func(i, j int) bool {
+		return client.cardValue(h.MostValuable[i].Card, false) > client.cardValue(h.MostValuable[j].Card, false)
+	})
+	if len(h.MostValuable) > 10 {
+		h.MostValuable = h.MostValuable[:10]
+	}
+
+	for _, n := range owners {
+		if n > 1 {
+			h.Shared++
+		}
+	}
+	return h, nil
+}
+
+func (client *Client) householdMember() (*HouseholdMember, error) {
+	member := &HouseholdMember{Collection: client.name}
+	result, err := client.cards().storageAggregate(mongo.Pipeline{
+		bson.D{
+			{"$group", bson.D{
+				{"_id", nil},
+				{"value", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.priceField(false), "$serra_count"}}}}}},
+				{"value_foil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.priceField(true), "$serra_count_foil"}}}}}},
+				{"value_etched", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.finishPriceField(FinishEtched), etchedCount}}}}}},
+				{"count", bson.D{{"$sum", bson.D{{"$add", bson.A{"$serra_count", "$serra_count_foil", etchedCount}}}}}},
+				{"unique", bson.D{{"$sum", 1}}},
+			}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// empty collection
+	if len(result) == 0 {
+		return member, nil
+	}
+
+	value, _ := getFloat64(result[0]["value"])
+	valueFoil, _ := getFloat64(result[0]["value_foil"])
+	valueEtched, _ := getFloat64(result[0]["value_etched"])
+	member.Value = value + valueFoil + valueEtched
+	member.Count, _ = getFloat64(result[0]["count"])
+	member.Unique, _ = getFloat64(result[0]["unique"])
+	return member, nil
+}
@@ -0,0 +1,223 @@
+package serra
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Prefix to look up a card by name in interactive mode
+const namePrefix = "n:"
+
+// Where to look up card names
+const (
+	lookupLocal    = 1 << iota // cards in the collection
+	lookupScryfall             // all cards known to scryfall
+)
+
+// CardSearch is a page of a card search on scryfall
+type CardSearch struct {
+	Data     []Card `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+// Cards given as set/collector number, like "usg/13", "sld/1a" or "pmid/1★".
+// Names may contain slashes too, like "Fire // Ice".
+var cardID = regexp.MustCompile(`(?i)^[a-z0-9]+/[0-9a-z★-]+$`)
+
+// isCardID returns true for cards given as set/collector number
+func isCardID(card string) bool {
+	return cardID.MatchString(card)
+}
+
+// fetchCardByName finds a card on scryfall by a fuzzy name like "bolt"
+func (s *Scryfall) fetchCardByName(name, set string) (*Card, error) {
+	params := url.Values{"fuzzy": {name}}
+	if set != "" {
+		params.Set("set", set)
+	}
+
+	resp, err := s.HTTP.Get(s.BaseURL + "/cards/named?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("No card found for %q", name)
+	}
+
+	card := &Card{}
+	if err := json.NewDecoder(resp.Body).Decode(card); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// fetchPrintings returns all printings of a card, optionally only those of
+// a set
+func (s *Scryfall) fetchPrintings(card *Card, set string) ([]Card, error) {
+	printings := []Card{}
+	next := card.PrintsSearchURI
+	for next != "" {
+		resp, err := s.HTTP.Get(next)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("No printings found for %q", card.Name)
+		}
+
+		page := CardSearch{}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range page.Data {
+			if set == "" || c.Set == set {
+				printings = append(printings, c)
+			}
+		}
+
+		next = ""
+		if page.HasMore {
+			next = page.NextPage
+		}
+	}
+	return printings, nil
+}
+
+// findCardsByName searches the collection for a card name. Exact matches
+// are preferred over cards only containing the name.
+func findCardsByName(coll *Collection, name, set string) ([]Card, error) {
+	for _, pattern := range []string{"^" + regexp.QuoteMeta(name) + "$", regexp.QuoteMeta(name)} {
+		filter := bson.D{{"name", bson.D{{"$regex", pattern}, {"$options", "i"}}}}
+		if set != "" {
+			filter = append(filter, bson.E{"set", set})
+		}
+
+		cards, err := coll.storageFind(filter, bson.D{{"releasedat", 1}}, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(cards) > 0 {
+			return cards, nil
+		}
+	}
+	return []Card{}, nil
+}
+
+// lookupCard resolves a card name to set/collector number. If the name
+// matches several printings, the user picks one of them.
+func (client *Client) lookupCard(name, set string, sources int, ask func(string) (string, error)) (string, error) {
+	set = strings.ToLower(set)
+
+	if sources&lookupLocal != 0 {
+		cards, err := findCardsByName(client.cards(), name, set)
+		if err != nil {
+			return "", err
+		}
+		if len(cards) > 0 {
+			return pickPrinting(client.valuation(), cards, ask)
+		}
+	}
+
+	if sources&lookupScryfall != 0 {
+		card, err := client.scryfall.fetchCardByName(name, set)
+		if err != nil {
+			return "", err
+		}
+
+		printings, err := client.scryfall.fetchPrintings(card, set)
+		if err != nil {
+			return "", err
+		}
+		if len(printings) > 0 {
+			return pickPrinting(client.valuation(), printings, ask)
+		}
+		return fmt.Sprintf("%s/%s", card.Set, card.CollectorNumber), nil
+	}
+
+	return "", fmt.Errorf("No card found for %q", name)
+}
+
+// pickPrinting lets the user choose one of several printings of a card
+func pickPrinting(v valuation, cards []Card, ask func(string) (string, error)) (string, error) {
+	if len(cards) == 1 {
+		return fmt.Sprintf("%s/%s", cards[0].Set, cards[0].CollectorNumber), nil
+	}
+
+	// the list goes to stderr, to keep machine readable output clean
+	fmt.Fprintf(os.Stderr, "%s%s%s has %d printings\n", Purple, cards[0].Name, Reset, len(cards))
+	for i, c := range cards {
+		fmt.Fprintf(os.Stderr, "%3d) %s%s/%s%s %s (%s, %s%.2f%s%s)\n", i+1, Cyan, c.Set, c.CollectorNumber, Reset, c.SetName, c.Rarity, Yellow, v.cardValue(c, false), v.symbol(), Reset)
+	}
+
+	answer, err := ask(fmt.Sprintf("Choose printing [1-%d]: ", len(cards)))
+	if err != nil {
+		return "", err
+	}
+
+	choice, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || choice < 1 || choice > len(cards) {
+		return "", fmt.Errorf("Invalid choice %q", strings.TrimSpace(answer))
+	}
+
+	c := cards[choice-1]
+	return fmt.Sprintf("%s/%s", c.Set, c.CollectorNumber), nil
+}
+
+// stdin is shared by all questions, so input buffered for one answer is not
+// lost for the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// askStdin asks a question on the terminal and returns the answer
+func askStdin(question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+	return stdin.ReadString('\n')
+}
+
+// askReadline asks a question within an interactive session
+func askReadline(rl *readline.Instance) func(string) (string, error) {
+	return func(question string) (string, error) {
+		prompt := rl.Config.Prompt
+		rl.SetPrompt(question)
+		defer rl.SetPrompt(prompt)
+		return rl.Readline()
+	}
+}
+
+// resolveCards replaces all card names in cards with set/collector number,
+// cards already given as set/collector number are kept
+func (client *Client) resolveCards(cards []string, set string, sources int) []string {
+	l := Logger()
+
+	resolved := []string{}
+	for _, card := range cards {
+		if isCardID(card) {
+			resolved = append(resolved, card)
+			continue
+		}
+
+		id, err := client.lookupCard(strings.TrimPrefix(card, namePrefix), set, sources, askStdin)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		resolved = append(resolved, id)
+	}
+	return resolved
+}
@@ -0,0 +1,21 @@
+package serra
+
+import "testing"
+
+func TestIsCardID(t *testing.T) {
+	for card, want := range map[string]bool{
+		"usg/13":              true,
+		"USG/013":             true,
+		"sld/1a":              true,
+		"pmid/1★":             true,
+		"usg/1-5":             true,
+		"Fire // Ice":         false,
+		"Fire//Ice":           false,
+		"Delver of Secrets/x": false,
+		"usg/":                false,
+	} {
+		if got := isCardID(card); got != want {
+			t.Errorf("isCardID(%q) = %v, want %v", card, got, want)
+		}
+	}
+}
@@ -21,64 +21,92 @@ var missingCmd = &cobra.Command{
 cards you dont own (yet) :)`,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, setName []string) error {
-		client := storageConnect()
-		coll := &Collection{client.Database("serra").Collection("cards")}
 		l := Logger()
-		defer storageDisconnect(client)
 
-		// fetch all cards in set
-		cards, err := coll.storageFind(bson.D{{"set", setName[0]}}, bson.D{{"collectornumber", 1}}, 0, 0)
-		if (err != nil) || len(cards) == 0 {
-			l.Errorf("Set %s not found or no card in your collection.", setName[0])
+		client, err := newClient()
+		if err != nil {
 			return err
 		}
+		defer client.Close()
 
-		// fetch set informations
-		setcoll := &Collection{client.Database("serra").Collection("sets")}
-		sets, _ := setcoll.storageFindSet(bson.D{{"code", setName[0]}}, bson.D{{"_id", 1}})
-		set := sets[0]
-
-		fmt.Printf("Missing cards in %s\n", sets[0].Name)
-
-		// generate set with all setnumbers
-		var (
-			completeSet []string
-			i           int64
-		)
-		for i = 1; i <= set.CardCount; i++ {
-			completeSet = append(completeSet, strconv.FormatInt(i, 10))
+		set, missingCards, err := client.missingCards(setName[0])
+		if err != nil {
+			l.Error(err)
+			return err
 		}
 
-		// iterate over all cards in collection
-		var inCollection []string
-		for _, c := range cards {
-			inCollection = append(inCollection, c.CollectorNumber)
+		list := CardList{}
+		for _, card := range missingCards {
+			o := newCardOutput(client.valuation(), card)
+			// not added yet, it is only fetched from scryfall
+			o.Added = ""
+			list = append(list, o)
 		}
 
-		misses := missing(inCollection, completeSet)
+		return render(list, func() {
+			fmt.Printf("Missing cards in %s\n", set.Name)
 
-		// Fetch all missing cards
-		missingCards := []*Card{}
-		for _, m := range misses {
-			card, err := fetchCard(setName[0], m)
-			if err != nil {
-				continue
+			for _, card := range missingCards {
+				fmt.Printf("%s%s/%s\t%s(%s, %shttps://scryfall.com/card/%s/%s%s)\t%s%.02f%s%s\t%s (%s)\n", Purple, card.Set, card.CollectorNumber, Reset, string([]rune(card.Rarity)[0]), Background, card.Set, card.CollectorNumber, Reset, Green, client.cardValue(*card, false), Reset, client.currencySymbol(), card.Name, card.SetName)
 			}
+		})
+	},
+}
 
-			missingCards = append(missingCards, card)
-		}
+// missingCards fetches all cards of a set from scryfall that are not in the
+// collection yet, sorted by collector number
+func (client *Client) missingCards(setCode string) (*Set, []*Card, error) {
+	coll := client.cards()
 
-		// Sort the missing cards by ID
-		sort.Slice(missingCards, func(i, j int) bool {
-			id1, _ := strconv.Atoi(missingCards[i].CollectorNumber)
-			id2, _ := strconv.Atoi(missingCards[j].CollectorNumber)
-			return id1 < id2
-		})
+	// fetch all cards in set
+	cards, err := coll.storageFind(bson.D{{"set", setCode}}, bson.D{{"collectornumber", 1}}, 0, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cards) == 0 {
+		return nil, nil, fmt.Errorf("Set %s not found or no card in your collection.", setCode)
+	}
 
-		for _, card := range missingCards {
-			fmt.Printf("%s%s/%s\t%s(%s, %shttps://scryfall.com/card/%s/%s%s)\t%s%.02f%s%s\t%s (%s)\n", Purple, card.Set, card.CollectorNumber, Reset, string([]rune(card.Rarity)[0]), Background, card.Set, card.CollectorNumber, Reset, Green, card.getValue(false), Reset, getCurrency(), card.Name, card.SetName)
+	// fetch set informations
+	set, err := findSetByCode(client.sets(), setCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// generate set with all setnumbers
+	var (
+		completeSet []string
+		i           int64
+	)
+	for i = 1; i <= set.CardCount; i++ {
+		completeSet = append(completeSet, strconv.FormatInt(i, 10))
+	}
+
+	// iterate over all cards in collection
+	var inCollection []string
+	for _, c := range cards {
+		inCollection = append(inCollection, c.CollectorNumber)
+	}
+
+	misses := missing(inCollection, completeSet)
+
+	// Fetch all missing cards
+	missingCards := []*Card{}
+	for _, m := range misses {
+		card, err := client.scryfall.fetchCard(setCode, m)
+		if err != nil {
+			continue
 		}
 
-		return nil
-	},
+		missingCards = append(missingCards, card)
+	}
+
+	// Sort the missing cards by ID
+	sort.Slice(missingCards, func(i, j int) bool {
+		id1, _ := strconv.Atoi(missingCards[i].CollectorNumber)
+		id2, _ := strconv.Atoi(missingCards[j].CollectorNumber)
+		return id1 < id2
+	})
+
+	return set, missingCards, nil
 }
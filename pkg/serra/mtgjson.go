@@ -0,0 +1,213 @@
+package serra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// MTGJSON price lists
+const (
+	MTGJSONRetail  = "retail"
+	MTGJSONBuylist = "buylist"
+)
+
+// MTGJSONPrices provides the prices of a vendor (tcgplayer, cardkingdom,
+// cardmarket, ...) of an MTGJSON AllPrices or AllPricesToday file. MTGJSON
+// identifies cards by its own ids, so the ids of TCGplayer and Cardmarket
+// are looked up in an AllIdentifiers file.
+type MTGJSONPrices struct {
+	vendor string
+	list   string
+
+	// latest prices by MTGJSON id
+	prices map[string]PriceEntry
+
+	// MTGJSON ids by TCGplayer and Cardmarket id
+	tcgplayer  map[string]string
+	cardmarket map[string]string
+}
+
+// ReadMTGJSONPrices reads the retail or buylist prices of a vendor
+func ReadMTGJSONPrices(prices, identifiers io.Reader, vendor, list string) (*MTGJSONPrices, error) {
+	if list != MTGJSONRetail && list != MTGJSONBuylist {
+		return nil, fmt.Errorf("Unknown price list %q, use %s or %s", list, MTGJSONRetail, MTGJSONBuylist)
+	}
+
+	m := &MTGJSONPrices{
+		vendor:     vendor,
+		list:       list,
+		prices:     map[string]PriceEntry{},
+		tcgplayer:  map[string]string{},
+		cardmarket: map[string]string{},
+	}
+	if err := m.readPrices(prices); err != nil {
+		return nil, fmt.Errorf("Could not read MTGJSON prices: %w", err)
+	}
+	if err := m.readIdentifiers(identifiers); err != nil {
+		return nil, fmt.Errorf("Could not read MTGJSON identifiers: %w", err)
+	}
+	return m, nil
+}
+
+// Name is like "mtgjson_cardkingdom" or "mtgjson_cardkingdom_buylist"
+func (m *MTGJSONPrices) Name() string {
+	if m.list == MTGJSONBuylist {
+		return "mtgjson_" + m.vendor + "_buylist"
+	}
+	return "mtgjson_" + m.vendor
+}
+
+func (m *MTGJSONPrices) Prices(card *Card) (*PriceEntry, error) {
+	id, ok := m.tcgplayer[strconv.FormatFloat(card.TCGPlayerID, 'f', 0, 64)]
+	if !ok || card.TCGPlayerID == 0 {
+		id, ok = m.cardmarket[strconv.FormatFloat(card.CardmarketID, 'f', 0, 64)]
+	}
+	if !ok || id == "" {
+		return nil, nil
+	}
+	p, ok := m.prices[id]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// mtgjsonVendorPrices are the prices of a vendor, by list, finish and date
+type mtgjsonVendorPrices struct {
+	Currency string                        `json:"currency"`
+	Retail   map[string]map[string]float64 `json:"retail"`
+	Buylist  map[string]map[string]float64 `json:"buylist"`
+}
+
+// readPrices reads the latest prices of the vendor, like
+//
+//	{"data": {"<id>": {"paper": {"cardkingdom": {"currency": "USD",
+//	  "retail": {"normal": {"2024-01-02": 1.99}, "foil": {...}}}}}}}
+func (m *MTGJSONPrices) readPrices(r io.Reader) error {
+	return readMTGJSONData(r, func(id string, dec *json.Decoder) error {
+		var entry struct {
+			Paper map[string]mtgjsonVendorPrices `json:"paper"`
+		}
+		if err := dec.Decode(&entry); err != nil {
+			return err
+		}
+		v, ok := entry.Paper[m.vendor]
+		if !ok {
+			return nil
+		}
+
+		finishes := v.Retail
+		if m.list == MTGJSONBuylist {
+			finishes = v.Buylist
+		}
+		p := PriceEntry{}
+		for finish, history := range finishes {
+			price := latestMTGJSONPrice(history)
+			switch {
+			case v.Currency == "EUR" && finish == "normal":
+				p.Eur = price
+			case v.Currency == "EUR" && finish == "foil":
+				p.EurFoil = price
+			case v.Currency == "USD" && finish == "normal":
+				p.Usd = price
+			case v.Currency == "USD" && finish == "foil":
+				p.UsdFoil = price
+			case v.Currency == "USD" && finish == "etched":
+				p.UsdEtched = price
+			}
+		}
+		m.prices[id] = p
+		return nil
+	})
+}
+
+// readIdentifiers reads the TCGplayer and Cardmarket ids of the cards, like
+//
+//	{"data": {"<id>": {"identifiers": {"mcmId": "1", "tcgplayerProductId": "2"}}}}
+func (m *MTGJSONPrices) readIdentifiers(r io.Reader) error {
+	return readMTGJSONData(r, func(id string, dec *json.Decoder) error {
+		var card struct {
+			Identifiers struct {
+				MCMID       string `json:"mcmId"`
+				TCGPlayerID string `json:"tcgplayerProductId"`
+			} `json:"identifiers"`
+		}
+		if err := dec.Decode(&card); err != nil {
+			return err
+		}
+		// only cards with prices are of interest
+		if _, ok := m.prices[id]; !ok {
+			return nil
+		}
+		if card.Identifiers.TCGPlayerID != "" {
+			m.tcgplayer[card.Identifiers.TCGPlayerID] = id
+		}
+		if card.Identifiers.MCMID != "" {
+			m.cardmarket[card.Identifiers.MCMID] = id
+		}
+		return nil
+	})
+}
+
+// readMTGJSONData calls fn for each entry of the data object of an MTGJSON
+// file. The files are large, so entries are decoded one by one.
+func readMTGJSONData(r io.Reader, fn func(id string, dec *json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "data" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '{'); err != nil {
+			return err
+		}
+		for dec.More() {
+			id, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := fn(fmt.Sprint(id), dec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("No data found")
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("Expected %s, found %v", delim, t)
+	}
+	return nil
+}
+
+// Returns the price of the latest day
+func latestMTGJSONPrice(history map[string]float64) float64 {
+	days := []string{}
+	for day := range history {
+		days = append(days, day)
+	}
+	if len(days) == 0 {
+		return 0
+	}
+	return history[slices.Max(days)]
+}
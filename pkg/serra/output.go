@@ -0,0 +1,163 @@
+package serra
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputCSV  = "csv"
+	OutputYAML = "yaml"
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&output, "output", OutputText, "Output format (text/json/csv/yaml)")
+}
+
+func checkOutput() error {
+	switch output {
+	case OutputText, OutputJSON, OutputCSV, OutputYAML:
+		return nil
+	}
+	return fmt.Errorf("Unknown output format %q, use %s, %s, %s or %s", output, OutputText, OutputJSON, OutputCSV, OutputYAML)
+}
+
+// Tabular is implemented by results that can be written as csv
+type Tabular interface {
+	Header() []string
+	Rows() [][]string
+}
+
+// render writes data in the configured output format. For text output the
+// human readable text function is called instead.
+func render(data any, text func()) error {
+	switch output {
+	case OutputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case OutputYAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(data)
+	case OutputCSV:
+		t, ok := data.(Tabular)
+		if !ok {
+			return fmt.Errorf("Output format csv is not supported for this command")
+		}
+		w := csv.NewWriter(os.Stdout)
+		w.Write(t.Header())
+		w.WriteAll(t.Rows())
+		return w.Error()
+	default:
+		text()
+		return nil
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// PricePoint is a single entry of a price history in the configured currency
+type PricePoint struct {
+	Date      string  `json:"date" yaml:"date"`
+	Value     float64 `json:"value" yaml:"value"`
+	ValueFoil float64 `json:"value_foil" yaml:"value_foil"`
+}
+
+func newPriceHistory(v valuation, prices []PriceEntry) []PricePoint {
+	history := []PricePoint{}
+	for _, e := range prices {
+		history = append(history, PricePoint{stringToTime(e.Date), v.priceValue(e, false), v.priceValue(e, true)})
+	}
+	return history
+}
+
+// CardOutput is the machine readable representation of a card in the collection
+type CardOutput struct {
+	Name            string       `json:"name" yaml:"name"`
+	Set             string       `json:"set" yaml:"set"`
+	SetName         string       `json:"set_name" yaml:"set_name"`
+	CollectorNumber string       `json:"collector_number" yaml:"collector_number"`
+	Rarity          string       `json:"rarity" yaml:"rarity"`
+	Count           int64        `json:"count" yaml:"count"`
+	CountFoil       int64        `json:"count_foil" yaml:"count_foil"`
+	CountEtched     int64        `json:"count_etched" yaml:"count_etched"`
+	Value           float64      `json:"value" yaml:"value"`
+	ValueFoil       float64      `json:"value_foil" yaml:"value_foil"`
+	Unpriced        int64        `json:"unpriced" yaml:"unpriced"`
+	Currency        string       `json:"currency" yaml:"currency"`
+	ScryfallURI     string       `json:"scryfall_uri" yaml:"scryfall_uri"`
+	Added           string       `json:"added,omitempty" yaml:"added,omitempty"`
+	Rotated         []string     `json:"rotated,omitempty" yaml:"rotated,omitempty"`
+	Legalities      []Legality   `json:"legalities,omitempty" yaml:"legalities,omitempty"`
+	History         []PricePoint `json:"history,omitempty" yaml:"history,omitempty"`
+}
+
+func newCardOutput(v valuation, c *Card) CardOutput {
+	o := CardOutput{
+		Name:            c.Name,
+		Set:             c.Set,
+		SetName:         c.SetName,
+		CollectorNumber: c.CollectorNumber,
+		Rarity:          c.Rarity,
+		Count:           c.SerraCount,
+		CountFoil:       c.SerraCountFoil,
+		CountEtched:     c.SerraCountEtched,
+		Value:           v.cardValue(*c, false),
+		ValueFoil:       v.cardValue(*c, true),
+		Unpriced:        v.unpriced(*c),
+		Currency:        v.currency,
+		ScryfallURI:     strings.Replace(c.ScryfallURI, "?utm_source=api", "", 1),
+	}
+	if c.SerraCreated != 0 {
+		o.Added = stringToTime(c.SerraCreated)
+	}
+	return o
+}
+
+// newCardDetailsOutput also contains price history and legalities
+func newCardDetailsOutput(v valuation, c *Card) CardOutput {
+	o := newCardOutput(v, c)
+	o.Legalities = c.LegalityList()
+	o.History = newPriceHistory(v, v.history(*c))
+	return o
+}
+
+// CardList is a list of cards that can be written as csv
+type CardList []CardOutput
+
+func newCardList(v valuation, cards []Card) CardList {
+	list := CardList{}
+	for i := range cards {
+		list = append(list, newCardOutput(v, &cards[i]))
+	}
+	return list
+}
+
+func (l CardList) Header() []string {
+	return []string{"name", "set", "set_name", "collector_number", "rarity", "count", "count_foil", "count_etched", "value", "value_foil", "currency", "scryfall_uri", "added", "unpriced"}
+}
+
+func (l CardList) Rows() [][]string {
+	rows := [][]string{}
+	for _, c := range l {
+		rows = append(rows, []string{
+			c.Name, c.Set, c.SetName, c.CollectorNumber, c.Rarity,
+			strconv.FormatInt(c.Count, 10), strconv.FormatInt(c.CountFoil, 10), strconv.FormatInt(c.CountEtched, 10),
+			formatFloat(c.Value), formatFloat(c.ValueFoil), c.Currency, c.ScryfallURI, c.Added, strconv.FormatInt(c.Unpriced, 10),
+		})
+	}
+	return rows
+}
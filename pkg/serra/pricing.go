@@ -0,0 +1,292 @@
+package serra
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Price sources of scryfall, TCGplayer in USD and Cardmarket in EUR
+const (
+	SourceUSD = "usd"
+	SourceEUR = "eur"
+)
+
+// Fallbacks for cards without a price of the preferred source
+const (
+	// the price of the other source, converted into the currency
+	FallbackConvert = "convert"
+
+	// foils are valued like the nonfoil card
+	FallbackNonfoil = "nonfoil"
+)
+
+// PricePolicy decides where the price of a card comes from. Cards are valued
+// by the preferred source first, then by the fallbacks of their finish in
+// the given order. Cards without any price are unpriced and count as 0.
+type PricePolicy struct {
+	// SourceUSD or SourceEUR, by default the source of the currency
+	Source string
+
+	Normal []string
+
+	// also used for etched cards
+	Foil []string
+}
+
+// DefaultPricePolicy converts the price of the other source, if the
+// preferred one has none
+func DefaultPricePolicy() PricePolicy {
+	return PricePolicy{Normal: []string{FallbackConvert}, Foil: []string{FallbackConvert}}
+}
+
+func (p PricePolicy) validate() error {
+	if p.Source != "" && p.Source != SourceUSD && p.Source != SourceEUR {
+		return fmt.Errorf("Unknown price source %q, use %s or %s", p.Source, SourceUSD, SourceEUR)
+	}
+	for _, f := range p.Normal {
+		if f != FallbackConvert {
+			return fmt.Errorf("Unknown fallback %q for nonfoil cards, use %s", f, FallbackConvert)
+		}
+	}
+	for _, f := range p.Foil {
+		if f != FallbackConvert && f != FallbackNonfoil {
+			return fmt.Errorf("Unknown fallback %q for foil cards, use %s or %s", f, FallbackConvert, FallbackNonfoil)
+		}
+	}
+	return nil
+}
+
+// parseFallbacks reads a comma separated list of fallbacks, "none" for no
+// fallback at all
+func parseFallbacks(s string) []string {
+	fallbacks := []string{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f != "" && f != "none" && !slices.Contains(fallbacks, f) {
+			fallbacks = append(fallbacks, f)
+		}
+	}
+	return fallbacks
+}
+
+func formatFallbacks(fallbacks []string) string {
+	if len(fallbacks) == 0 {
+		return "none"
+	}
+	return strings.Join(fallbacks, ",")
+}
+
+// valuation calculates the value of cards in a currency
+type valuation struct {
+	currency string
+	rates    RateTable
+	policy   PricePolicy
+
+	// price provider the cards are valued by
+	provider string
+}
+
+// fields returns the storage fields of the current prices and the price
+// history of the valuation source
+func (v valuation) fields() (string, string) {
+	return providerFields(v.provider)
+}
+
+// source returns the preferred price source
+func (v valuation) source() string {
+	switch {
+	case v.policy.Source != "":
+		return v.policy.Source
+	case v.currency == "USD":
+		return SourceUSD
+	}
+	return SourceEUR
+}
+
+func otherSource(source string) string {
+	if source == SourceUSD {
+		return SourceEUR
+	}
+	return SourceUSD
+}
+
+// Returns the currency prices of a source are in
+func sourceCurrency(source string) string {
+	return strings.ToUpper(source)
+}
+
+// check makes sure the rates to convert prices of all sources are known
+func (v valuation) check() error {
+	latest := v.rates.latest()
+	sources := []string{v.source()}
+	if slices.Contains(v.policy.Normal, FallbackConvert) || slices.Contains(v.policy.Foil, FallbackConvert) {
+		sources = append(sources, otherSource(v.source()))
+	}
+	for _, s := range sources {
+		// without rates, prices of the other source are simply not used
+		if _, ok := latest.factor(sourceCurrency(s), v.currency); !ok && (s == v.source() || len(v.rates) > 0) {
+			return fmt.Errorf("No exchange rate to convert %s into %s, see serra rates import --help", sourceCurrency(s), v.currency)
+		}
+	}
+	return nil
+}
+
+// value returns the price of a finish in the currency, converted with the
+// rates of the day it was recorded. ok is false for unpriced cards.
+func (v valuation) value(p PriceEntry, finish string) (float64, bool) {
+	prices := map[string]float64{SourceUSD: p.Usd, SourceEUR: p.Eur}
+	fallbacks := v.policy.Normal
+	switch finish {
+	case FinishFoil, FinishEtched:
+		prices = map[string]float64{SourceUSD: p.UsdFoil, SourceEUR: p.EurFoil}
+		if finish == FinishEtched && p.UsdEtched > 0 {
+			prices[SourceUSD] = p.UsdEtched
+		}
+		fallbacks = v.policy.Foil
+	}
+
+	r := v.rates.at(p.Date)
+	source := v.source()
+	if prices[source] > 0 {
+		if value, ok := r.exchange(prices[source], sourceCurrency(source), v.currency); ok {
+			return value, true
+		}
+	}
+	for _, f := range fallbacks {
+		switch f {
+		case FallbackConvert:
+			other := otherSource(source)
+			if prices[other] > 0 {
+				if value, ok := r.exchange(prices[other], sourceCurrency(other), v.currency); ok {
+					return value, true
+				}
+			}
+		case FallbackNonfoil:
+			return v.value(p, FinishNormal)
+		}
+	}
+
+	// etched cards without etched or foil price are valued like nonfoil cards
+	if finish == FinishEtched {
+		return v.value(p, FinishNormal)
+	}
+	return 0, false
+}
+
+// finishValue returns the value of a price entry in the given finish.
+// Etched cards fall back to the foil price, if there is no etched price, and
+// to the nonfoil price last. Unpriced cards are worth 0.
+func (v valuation) finishValue(p PriceEntry, finish string) float64 {
+	value, _ := v.value(p, finish)
+	return value
+}
+
+// priceValue returns the value of a nonfoil or foil price entry
+func (v valuation) priceValue(p PriceEntry, foil bool) float64 {
+	if foil {
+		return v.finishValue(p, FinishFoil)
+	}
+	return v.finishValue(p, FinishNormal)
+}
+
+// cardValue returns the value of a single nonfoil or foil card
+func (v valuation) cardValue(c Card, foil bool) float64 {
+	return v.priceValue(v.prices(c), foil)
+}
+
+// cardFinishValue returns the value of a single card in the given finish
+func (v valuation) cardFinishValue(c Card, finish string) float64 {
+	return v.finishValue(v.prices(c), finish)
+}
+
+// unpriced returns the amount of owned copies of a card without price
+func (v valuation) unpriced(c Card) int64 {
+	var unpriced int64
+	for _, finish := range []string{FinishNormal, FinishFoil, FinishEtched} {
+		if _, ok := v.value(v.prices(c), finish); !ok {
+			unpriced += c.getCount(finish)
+		}
+	}
+	return unpriced
+}
+
+// symbol returns the human readable name of the currency
+func (v valuation) symbol() string {
+	return currencySymbol(v.currency)
+}
+
+// expr returns the price of the normal or foil finish of a price entry, like
+// "$prices", as storage expression converted with the given rates. The
+// expression is null for unpriced cards.
+func (v valuation) expr(entry string, r Rates, foil bool) interface{} {
+	if foil {
+		return v.finishExpr(entry, r, FinishFoil)
+	}
+	return v.finishExpr(entry, r, FinishNormal)
+}
+
+// finishExpr returns the price of a finish of a price entry as storage
+// expression, with the same fallbacks as value
+func (v valuation) finishExpr(entry string, r Rates, finish string) interface{} {
+	fallbacks := v.policy.Normal
+	price := func(source string) interface{} {
+		return entry + "." + source
+	}
+	switch finish {
+	case FinishFoil, FinishEtched:
+		fallbacks = v.policy.Foil
+		price = func(source string) interface{} {
+			foil := entry + "." + source + "_foil"
+			if finish == FinishEtched && source == SourceUSD {
+				etched := entry + ".usd_etched"
+				return bson.D{{"$cond", bson.A{bson.D{{"$gt", bson.A{etched, 0}}}, etched, foil}}}
+			}
+			return foil
+		}
+	}
+
+	source := v.source()
+	candidates := []interface{}{}
+	if e, ok := r.exchangeExpr(price(source), sourceCurrency(source), v.currency); ok {
+		candidates = append(candidates, e)
+	}
+	for _, f := range fallbacks {
+		switch f {
+		case FallbackConvert:
+			other := otherSource(source)
+			if e, ok := r.exchangeExpr(price(other), sourceCurrency(other), v.currency); ok {
+				candidates = append(candidates, e)
+			}
+		case FallbackNonfoil:
+			candidates = append(candidates, v.finishExpr(entry, r, FinishNormal))
+		}
+	}
+	if finish == FinishEtched {
+		candidates = append(candidates, v.finishExpr(entry, r, FinishNormal))
+	}
+
+	// the first candidate with a price wins
+	var expr interface{}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		expr = bson.D{{"$cond", bson.A{bson.D{{"$gt", bson.A{candidates[i], 0}}}, candidates[i], expr}}}
+	}
+	return expr
+}
+
+// etchedCount is the amount of etched copies of a card. Cards stored before
+// etched finishes were tracked have no etched count at all.
+var etchedCount = bson.D{{"$ifNull", bson.A{"$serra_count_etched", 0}}}
+
+// valueExpr is the value of the copies of a card in a finish, 0 for unpriced
+// cards, so it can be added to the value of other finishes
+func valueExpr(price interface{}, count interface{}) bson.D {
+	return bson.D{{"$multiply", bson.A{bson.D{{"$ifNull", bson.A{price, 0}}}, count}}}
+}
+
+// unpricedExpr counts the copies of a card without price
+func unpricedExpr(price interface{}, count interface{}) bson.D {
+	return bson.D{{"$cond", bson.A{bson.D{{"$gt", bson.A{price, 0}}}, 0, count}}}
+}
@@ -0,0 +1,262 @@
+package serra
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Conditions and languages understood by the interactive prompt. Serra does
+// not track them, they are only echoed.
+var (
+	promptConditions = []string{"m", "nm", "ex", "gd", "lp", "pl", "mp", "hp", "po", "dmg"}
+	promptLanguages  = []string{"en", "de", "fr", "it", "es", "pt", "ja", "ko", "ru", "zhs", "zht", "ph"}
+)
+
+// PromptEntry is a parsed line of an interactive session, like "1-5 f 3".
+// The first word is a collector number or a range of collector numbers, the
+// following words are in any order:
+//
+//	f, foil      foil finish
+//	e, etched    etched finish
+//	3            amount of cards
+//	nm, de       condition and language
+type PromptEntry struct {
+	Numbers   []string
+	Finish    string
+	Count     int64
+	Condition string
+	Language  string
+}
+
+// Card identifiers of the entry within a set, like "usg/13"
+func (e *PromptEntry) Cards(set string) []string {
+	cards := []string{}
+	for _, n := range e.Numbers {
+		cards = append(cards, fmt.Sprintf("%s/%s", set, n))
+	}
+	return cards
+}
+
+// Notes returns condition and language of the entry, if given
+func (e *PromptEntry) Notes() string {
+	notes := []string{}
+	for _, n := range []string{e.Condition, e.Language} {
+		if n != "" {
+			notes = append(notes, n)
+		}
+	}
+	return strings.Join(notes, " ")
+}
+
+func parsePromptLine(line string) (*PromptEntry, error) {
+	words := strings.Fields(strings.ToLower(line))
+	if len(words) == 0 {
+		return nil, fmt.Errorf("Empty input")
+	}
+
+	entry := &PromptEntry{Finish: FinishNormal, Count: 1}
+
+	numbers, err := parsePromptNumbers(words[0])
+	if err != nil {
+		return nil, err
+	}
+	entry.Numbers = numbers
+
+	for _, w := range words[1:] {
+		switch {
+		case w == "f" || w == "foil":
+			entry.Finish = FinishFoil
+		case w == "e" || w == "etched":
+			entry.Finish = FinishEtched
+		case slices.Contains(promptConditions, w):
+			entry.Condition = w
+		case slices.Contains(promptLanguages, w):
+			entry.Language = w
+		default:
+			amount, err := strconv.ParseInt(w, 10, 64)
+			if err != nil || amount < 1 {
+				return nil, fmt.Errorf("Unknown input %q, use f (foil), e (etched), an amount, a condition or a language", w)
+			}
+			entry.Count = amount
+		}
+	}
+
+	return entry, nil
+}
+
+// parsePromptNumbers expands a collector number or a range like "1-5"
+func parsePromptNumbers(word string) ([]string, error) {
+	parts := strings.Split(word, "-")
+	if len(parts) == 1 {
+		number := strings.TrimLeft(word, "0")
+		if number == "" {
+			return nil, fmt.Errorf("Invalid collector number %q", word)
+		}
+		return []string{number}, nil
+	}
+
+	start, err1 := strconv.Atoi(parts[0])
+	end, err2 := strconv.Atoi(parts[1])
+	if len(parts) != 2 || err1 != nil || err2 != nil || start < 1 || end < start {
+		return nil, fmt.Errorf("Invalid range %q, use a range like 1-5", word)
+	}
+
+	numbers := []string{}
+	for i := start; i <= end; i++ {
+		numbers = append(numbers, strconv.Itoa(i))
+	}
+	return numbers, nil
+}
+
+// CardChange is an amount of a card added to (or removed from, if negative)
+// the collection. Card is the state before the change.
+type CardChange struct {
+	Card    Card
+	Finish  string
+	Amount  int64
+	Created bool // card was not in the collection before
+	Deleted bool // last copy of the card was removed
+}
+
+// checkCount makes sure an amount of cards to change is positive
+func checkCount(count int64) error {
+	if count < 1 {
+		return fmt.Errorf("Invalid count %d, use at least 1", count)
+	}
+	return nil
+}
+
+// changeValue returns the value of the changed amount of cards
+func (v valuation) changeValue(c CardChange) float64 {
+	return v.cardFinishValue(c.Card, c.Finish) * float64(c.Amount)
+}
+
+// promptSession keeps track of the changes of an interactive session, to be
+// able to undo them and to summarize them at the end
+type promptSession struct {
+	set     string
+	entries [][]CardChange
+}
+
+func (s *promptSession) record(changes []CardChange) {
+	if len(changes) > 0 {
+		s.entries = append(s.entries, changes)
+	}
+}
+
+// undo reverts the changes of the last entry
+func (s *promptSession) undo(coll *Collection, v valuation) error {
+	l := Logger()
+	if len(s.entries) == 0 {
+		return fmt.Errorf("Nothing to undo")
+	}
+
+	last := s.entries[len(s.entries)-1]
+	s.entries = s.entries[:len(s.entries)-1]
+
+	for _, c := range last {
+		if c.Created {
+			if err := coll.storageRemove(bson.M{"_id": c.Card.ID}); err != nil {
+				return err
+			}
+			l.Infof("\"%s\" (%s/%s) removed again", c.Card.Name, c.Card.Set, c.Card.CollectorNumber)
+			continue
+		}
+		if c.Deleted {
+			if err := coll.storageAdd(&c.Card); err != nil {
+				return err
+			}
+			l.Infof("\"%s\" (%s/%s) added again", c.Card.Name, c.Card.Set, c.Card.CollectorNumber)
+			continue
+		}
+		if _, err := modifyCardCount(coll, v, &c.Card, -c.Amount, c.Finish); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summary returns the amount and value of all changes in the session
+func (s *promptSession) summary(v valuation) (int64, float64) {
+	var (
+		count int64
+		value float64
+	)
+	for _, entry := range s.entries {
+		for _, c := range entry {
+			count += c.Amount
+			value += v.changeValue(c)
+		}
+	}
+	return count, value
+}
+
+// runPrompt reads the lines of an interactive session until it ends. Besides
+// entries, it understands "u" to undo the last entry, ":set <code>" to switch
+// the set and "n:<name>" to look up a card by name. Entries are passed to
+// apply, which returns the changes made to the collection.
+func (client *Client) runPrompt(set string, sources int, apply func(rl *readline.Instance, cards []string, entry *PromptEntry) []CardChange) (*promptSession, error) {
+	l := Logger()
+
+	rl, err := readline.New(fmt.Sprintf("%s> ", set))
+	if err != nil {
+		return nil, err
+	}
+	defer rl.Close()
+
+	session := &promptSession{set: set}
+	for {
+		line, err := rl.Readline()
+		if err != nil { // io.EOF
+			break
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+			continue
+
+		// undo last entry
+		case line == "u" || line == "undo":
+			if err := session.undo(client.cards(), client.valuation()); err != nil {
+				l.Error(err)
+			}
+			continue
+
+		// switch to another set
+		case strings.HasPrefix(line, ":set "):
+			session.set = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, ":set ")))
+			rl.SetPrompt(fmt.Sprintf("%s> ", session.set))
+			continue
+
+		// lookup card by name within the set
+		case strings.HasPrefix(line, namePrefix):
+			id, err := client.lookupCard(strings.TrimSpace(strings.TrimPrefix(line, namePrefix)), session.set, sources, askReadline(rl))
+			if err != nil {
+				l.Error(err)
+				continue
+			}
+			session.record(apply(rl, []string{id}, &PromptEntry{Finish: FinishNormal, Count: 1}))
+			continue
+		}
+
+		entry, err := parsePromptLine(line)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+
+		if notes := entry.Notes(); notes != "" {
+			l.Infof("Condition and language (%s) are not tracked", notes)
+		}
+
+		session.record(apply(rl, entry.Cards(session.set), entry))
+	}
+
+	return session, nil
+}
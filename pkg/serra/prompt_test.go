@@ -0,0 +1,35 @@
+package serra
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePromptLine(t *testing.T) {
+	// words after the collector number may come in any order
+	want := &PromptEntry{Numbers: []string{"13"}, Finish: FinishFoil, Count: 4, Condition: "lp", Language: "de"}
+	for _, line := range []string{"013 f 4 lp de", "13 DE lp 4 foil"} {
+		got, err := parsePromptLine(line)
+		if err != nil {
+			t.Errorf("parsePromptLine(%q) failed: %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parsePromptLine(%q) = %+v, want %+v", line, got, want)
+		}
+	}
+
+	got, err := parsePromptLine("1-3 e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Numbers, []string{"1", "2", "3"}) || got.Finish != FinishEtched || got.Count != 1 {
+		t.Errorf("parsePromptLine(\"1-3 e\") = %+v", got)
+	}
+
+	for _, line := range []string{"", "0", "13 0", "13 x", "5-1", "1-2-3"} {
+		if got, err := parsePromptLine(line); err == nil {
+			t.Errorf("parsePromptLine(%q) = %+v, want error", line, got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package serra
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// PriceProvider knows the current prices of cards. Scryfall is the default
+// provider, others are updated along with it and keep their own price
+// history on each card.
+type PriceProvider interface {
+	// Name identifies the prices of the provider in the storage, like
+	// "cardmarket"
+	Name() string
+
+	// Prices returns the current prices of a card, nil if the provider does
+	// not know the card
+	Prices(card *Card) (*PriceEntry, error)
+}
+
+// Name of the default provider, whose prices come with the card from scryfall
+const ScryfallProvider = "scryfall"
+
+var providerName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// scryfallPrices returns the prices scryfall sent along with the card
+type scryfallPrices struct{}
+
+func (scryfallPrices) Name() string {
+	return ScryfallProvider
+}
+
+func (scryfallPrices) Prices(card *Card) (*PriceEntry, error) {
+	p := card.Prices
+	return &p, nil
+}
+
+// providerFields returns the storage fields of the current prices and the
+// price history of a provider. Scryfall prices are stored like before other
+// providers existed.
+func providerFields(provider string) (string, string) {
+	if provider == "" || provider == ScryfallProvider {
+		return "prices", "serra_prices"
+	}
+	return "provider_prices." + provider, "serra_provider_prices." + provider
+}
+
+// checkProviders makes sure all providers can be stored side by side
+func checkProviders(providers []PriceProvider) error {
+	seen := map[string]bool{ScryfallProvider: true}
+	for _, p := range providers {
+		if !providerName.MatchString(p.Name()) {
+			return fmt.Errorf("Invalid price provider name %q, use lowercase letters, digits and _", p.Name())
+		}
+		if seen[p.Name()] {
+			return fmt.Errorf("Price provider %s is used twice", p.Name())
+		}
+		seen[p.Name()] = true
+	}
+	return nil
+}
+
+// prices returns the current prices of a card by the provider the
+// collection is valued by
+func (v valuation) prices(c Card) PriceEntry {
+	if v.provider == "" || v.provider == ScryfallProvider {
+		return c.Prices
+	}
+	return c.ProviderPrices[v.provider]
+}
+
+// history returns the price history of a card by the provider the
+// collection is valued by
+func (v valuation) history(c Card) []PriceEntry {
+	if v.provider == "" || v.provider == ScryfallProvider {
+		return c.SerraPrices
+	}
+	return c.SerraProviderPrices[v.provider]
+}
@@ -0,0 +1,427 @@
+package serra
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Comparison operators of the query language
+const (
+	opColon        = ":"
+	opEqual        = "="
+	opNotEqual     = "!="
+	opLess         = "<"
+	opLessEqual    = "<="
+	opGreater      = ">"
+	opGreaterEqual = ">="
+)
+
+// Operators ordered by length, so "<=" is found before "<"
+var queryOperators = []string{opNotEqual, opLessEqual, opGreaterEqual, opColon, opEqual, opLess, opGreater}
+
+var rarityOrder = []string{"common", "uncommon", "rare", "mythic"}
+
+var colorNames = map[string]string{
+	"white": "W",
+	"blue":  "U",
+	"black": "B",
+	"red":   "R",
+	"green": "G",
+}
+
+// queryTerm is a single condition of a query like "-o:flying"
+type queryTerm struct {
+	negate bool
+	key    string
+	op     string
+	value  string
+}
+
+// parseQuery compiles a scryfall like query string into a storage filter.
+// Terms are combined with AND, "or" combines the terms left and right of it.
+//
+//	t:creature c>=ug cmc<=3 r:rare usd>2 a:"Rebecca Guay" is:foil set:usg -o:flying
+func parseQuery(query string) (bson.D, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []bson.A{{}}
+	for _, token := range tokens {
+		if strings.EqualFold(token, "or") {
+			groups = append(groups, bson.A{})
+			continue
+		}
+
+		term := parseTerm(token)
+		filter, err := term.filter()
+		if err != nil {
+			return nil, err
+		}
+		if term.negate {
+			filter = bson.D{{"$nor", bson.A{filter}}}
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], filter)
+	}
+
+	if len(tokens) == 0 {
+		return bson.D{}, nil
+	}
+
+	or := bson.A{}
+	for _, group := range groups {
+		if len(group) == 0 {
+			return nil, fmt.Errorf("Invalid query %q, \"or\" needs terms on both sides", query)
+		}
+		or = append(or, bson.D{{"$and", group}})
+	}
+
+	// the filter is wrapped, so it does not collide with other filters on
+	// the same fields
+	if len(or) == 1 {
+		return or[0].(bson.D), nil
+	}
+	return bson.D{{"$or", or}}, nil
+}
+
+// tokenizeQuery splits a query at whitespace, respecting double quotes
+func tokenizeQuery(query string) ([]string, error) {
+	tokens := []string{}
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("Invalid query %q, missing closing quote", query)
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+// parseTerm splits a token into negation, key, operator and value. Tokens
+// without operator are searched in the card name.
+func parseTerm(token string) queryTerm {
+	term := queryTerm{}
+	if strings.HasPrefix(token, "-") && len(token) > 1 {
+		term.negate = true
+		token = token[1:]
+	}
+
+	// a quoted token is always a name, even if it contains an operator
+	if !strings.HasPrefix(token, "\"") {
+		for i, r := range token {
+			if !unicode.IsLetter(r) {
+				for _, op := range queryOperators {
+					if i > 0 && strings.HasPrefix(token[i:], op) {
+						term.key = strings.ToLower(token[:i])
+						term.op = op
+						term.value = strings.Trim(token[i+len(op):], "\"")
+						return term
+					}
+				}
+				break
+			}
+		}
+	}
+
+	term.key = "name"
+	term.op = opColon
+	term.value = strings.Trim(token, "\"")
+	return term
+}
+
+func (t queryTerm) filter() (bson.D, error) {
+	if t.value == "" {
+		return nil, fmt.Errorf("Invalid query term %q, missing value", t.key+t.op)
+	}
+
+	switch t.key {
+	case "name", "n":
+		return t.regexFilter("name")
+	case "t", "type":
+		return t.regexFilter("typeline")
+	case "o", "oracle":
+		return t.regexFilter("oracletext")
+	case "a", "artist":
+		return t.regexFilter("artist")
+	case "s", "e", "set", "edition":
+		return t.equalFilter("set", strings.ToLower(t.value))
+	case "cn", "number":
+		return t.equalFilter("collectornumber", strings.TrimLeft(t.value, "0"))
+	case "r", "rarity":
+		return t.rarityFilter()
+	case "cmc", "mv", "manavalue":
+		return t.numberFilter("cmc")
+	case "usd", "eur", "tix":
+		return t.numberFilter("prices." + t.key)
+	case "year":
+		return t.yearFilter()
+	case "c", "color":
+		return t.colorFilter("colors", opGreaterEqual)
+	case "id", "identity", "ci":
+		return t.colorFilter("coloridentity", opLessEqual)
+	case "f", "format", "legal":
+		return t.legalityFilter("legal")
+	case "banned":
+		return t.legalityFilter("banned")
+	case "restricted":
+		return t.legalityFilter("restricted")
+	case "is", "has":
+		return t.isFilter()
+	}
+
+	return nil, fmt.Errorf("Unknown query keyword %q", t.key)
+}
+
+func (t queryTerm) regexFilter(field string) (bson.D, error) {
+	if t.op != opColon && t.op != opEqual {
+		return nil, fmt.Errorf("Invalid operator %q for %s, use \":\"", t.op, t.key)
+	}
+	return bson.D{{field, bson.D{{"$regex", regexp.QuoteMeta(t.value)}, {"$options", "i"}}}}, nil
+}
+
+func (t queryTerm) equalFilter(field string, value interface{}) (bson.D, error) {
+	switch t.op {
+	case opColon, opEqual:
+		return bson.D{{field, value}}, nil
+	case opNotEqual:
+		return bson.D{{field, bson.D{{"$ne", value}}}}, nil
+	}
+	return nil, fmt.Errorf("Invalid operator %q for %s, use \":\"", t.op, t.key)
+}
+
+func (t queryTerm) legalityFilter(status string) (bson.D, error) {
+	format := strings.ToLower(t.value)
+	if !isFormat(format) {
+		return nil, fmt.Errorf("Unknown format %q", t.value)
+	}
+	return t.equalFilter("legalities."+format, status)
+}
+
+func (t queryTerm) compare(field string, value interface{}) bson.D {
+	switch t.op {
+	case opNotEqual:
+		return bson.D{{field, bson.D{{"$ne", value}}}}
+	case opLess:
+		return bson.D{{field, bson.D{{"$lt", value}}}}
+	case opLessEqual:
+		return bson.D{{field, bson.D{{"$lte", value}}}}
+	case opGreater:
+		return bson.D{{field, bson.D{{"$gt", value}}}}
+	case opGreaterEqual:
+		return bson.D{{field, bson.D{{"$gte", value}}}}
+	}
+	return bson.D{{field, value}}
+}
+
+func (t queryTerm) numberFilter(field string) (bson.D, error) {
+	value, err := strconv.ParseFloat(t.value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid number %q for %s", t.value, t.key)
+	}
+	return t.compare(field, value), nil
+}
+
+func (t queryTerm) yearFilter() (bson.D, error) {
+	year, err := strconv.Atoi(t.value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid year %q", t.value)
+	}
+
+	// releasedat is stored as string like "1998-10-12"
+	start := fmt.Sprintf("%04d-01-01", year)
+	next := fmt.Sprintf("%04d-01-01", year+1)
+	switch t.op {
+	case opColon, opEqual:
+		return bson.D{{"releasedat", bson.D{{"$gte", start}, {"$lt", next}}}}, nil
+	case opNotEqual:
+		return bson.D{{"$or", bson.A{bson.D{{"releasedat", bson.D{{"$lt", start}}}}, bson.D{{"releasedat", bson.D{{"$gte", next}}}}}}}, nil
+	case opLess:
+		return bson.D{{"releasedat", bson.D{{"$lt", start}}}}, nil
+	case opLessEqual:
+		return bson.D{{"releasedat", bson.D{{"$lt", next}}}}, nil
+	case opGreater:
+		return bson.D{{"releasedat", bson.D{{"$gte", next}}}}, nil
+	default:
+		return bson.D{{"releasedat", bson.D{{"$gte", start}}}}, nil
+	}
+}
+
+func (t queryTerm) rarityFilter() (bson.D, error) {
+	value := strings.ToLower(t.value)
+	for _, r := range rarityOrder {
+		if strings.HasPrefix(r, value) {
+			value = r
+			break
+		}
+	}
+
+	index := -1
+	for i, r := range rarityOrder {
+		if r == value {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("Unknown rarity %q, use common, uncommon, rare or mythic", t.value)
+	}
+
+	var rarities []string
+	switch t.op {
+	case opLess:
+		rarities = rarityOrder[:index]
+	case opLessEqual:
+		rarities = rarityOrder[:index+1]
+	case opGreater:
+		rarities = rarityOrder[index+1:]
+	case opGreaterEqual:
+		rarities = rarityOrder[index:]
+	default:
+		return t.equalFilter("rarity", value)
+	}
+	return bson.D{{"rarity", bson.D{{"$in", rarities}}}}, nil
+}
+
+func (t queryTerm) colorFilter(field, colonOp string) (bson.D, error) {
+	value := strings.ToLower(t.value)
+
+	if value == "m" || value == "multicolor" {
+		return bson.D{{field + ".1", bson.D{{"$exists", true}}}}, nil
+	}
+
+	colors, err := parseColors(value)
+	if err != nil {
+		return nil, err
+	}
+
+	op := t.op
+	if op == opColon {
+		op = colonOp
+		// colorless is always an exact match
+		if len(colors) == 0 {
+			op = opEqual
+		}
+	}
+
+	switch op {
+	case opEqual:
+		return colorFilter(field, colors, ColorExact), nil
+	case opNotEqual:
+		return bson.D{{"$nor", bson.A{colorFilter(field, colors, ColorExact)}}}, nil
+	case opGreaterEqual:
+		return colorFilter(field, colors, ColorIncludes), nil
+	case opLessEqual:
+		return colorFilter(field, colors, ColorWithin), nil
+	case opGreater:
+		return bson.D{{"$and", bson.A{
+			colorFilter(field, colors, ColorIncludes),
+			bson.D{{field + "." + strconv.Itoa(len(colors)), bson.D{{"$exists", true}}}},
+		}}}, nil
+	default:
+		return bson.D{{"$and", bson.A{
+			colorFilter(field, colors, ColorWithin),
+			bson.D{{"$nor", bson.A{colorFilter(field, colors, ColorExact)}}},
+		}}}, nil
+	}
+}
+
+func (t queryTerm) isFilter() (bson.D, error) {
+	if t.op != opColon && t.op != opEqual {
+		return nil, fmt.Errorf("Invalid operator %q for %s, use \":\"", t.op, t.key)
+	}
+
+	switch strings.ToLower(t.value) {
+	case "foil":
+		return bson.D{{"serra_count_foil", bson.D{{"$gt", 0}}}}, nil
+	case "nonfoil":
+		return bson.D{{"serra_count", bson.D{{"$gt", 0}}}}, nil
+	case "etched":
+		return bson.D{{"serra_count_etched", bson.D{{"$gt", 0}}}}, nil
+	case "reserved":
+		return bson.D{{"reserved", true}}, nil
+	case "reprint":
+		return bson.D{{"reprint", true}}, nil
+	case "promo":
+		return bson.D{{"promo", true}}, nil
+	case "fullart", "full":
+		return bson.D{{"fullart", true}}, nil
+	}
+	return nil, fmt.Errorf("Unknown value %q for %s", t.value, t.key)
+}
+
+// Modes to match colors of a card
+const (
+	ColorExact    = "exact"
+	ColorIncludes = "includes"
+	ColorWithin   = "within"
+)
+
+// parseColors converts a color string like "ug", "u,g", "blue" or
+// "colorless" into the color symbols stored by scryfall
+func parseColors(value string) ([]string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "c" || value == "colorless" {
+		return []string{}, nil
+	}
+	if symbol, ok := colorNames[value]; ok {
+		return []string{symbol}, nil
+	}
+
+	colors := []string{}
+	seen := map[string]bool{}
+	for _, r := range strings.ReplaceAll(value, ",", "") {
+		symbol := strings.ToUpper(string(r))
+		if !strings.Contains("WUBRG", symbol) {
+			return nil, fmt.Errorf("Unknown color %q, use w, u, b, r, g or c for colorless", string(r))
+		}
+		if !seen[symbol] {
+			seen[symbol] = true
+			colors = append(colors, symbol)
+		}
+	}
+	return colors, nil
+}
+
+// colorFilter matches a color array independent of the order of its colors.
+// Exact matches exactly the colors, includes matches cards having at least
+// the colors and within matches cards having no other colors (like the color
+// identity of a commander deck).
+func colorFilter(field string, colors []string, mode string) bson.D {
+	switch mode {
+	case ColorIncludes:
+		// including no colors would match every card, so colorless is
+		// always matched exactly
+		if len(colors) > 0 {
+			return bson.D{{field, bson.D{{"$all", colors}}}}
+		}
+	case ColorWithin:
+		return bson.D{{field, bson.D{{"$not", bson.D{{"$elemMatch", bson.D{{"$nin", colors}}}}}}}}
+	}
+
+	if len(colors) == 0 {
+		return bson.D{{field, bson.D{{"$size", 0}}}}
+	}
+	return bson.D{{field, bson.D{{"$all", colors}, {"$size", len(colors)}}}}
+}
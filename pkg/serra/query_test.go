@@ -0,0 +1,85 @@
+package serra
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseTerm(t *testing.T) {
+	tests := []struct {
+		token string
+		want  queryTerm
+	}{
+		// longer operators win over their prefixes
+		{"CMC<=3", queryTerm{key: "cmc", op: opLessEqual, value: "3"}},
+		{"c!=ug", queryTerm{key: "c", op: opNotEqual, value: "ug"}},
+		{"-o:flying", queryTerm{negate: true, key: "o", op: opColon, value: "flying"}},
+		{`a:"Rebecca Guay"`, queryTerm{key: "a", op: opColon, value: "Rebecca Guay"}},
+		// quoted tokens are names, even with an operator inside
+		{`"t:creature"`, queryTerm{key: "name", op: opColon, value: "t:creature"}},
+		{`-"Fire // Ice"`, queryTerm{negate: true, key: "name", op: opColon, value: "Fire // Ice"}},
+		// a lone dash is no negation
+		{"-", queryTerm{key: "name", op: opColon, value: "-"}},
+	}
+
+	for _, tt := range tests {
+		if got := parseTerm(tt.token); got != tt.want {
+			t.Errorf("parseTerm(%q) = %+v, want %+v", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	foil := bson.D{{"serra_count_foil", bson.D{{"$gt", 0}}}}
+
+	got, err := parseQuery("-is:foil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (bson.D{{"$and", bson.A{bson.D{{"$nor", bson.A{foil}}}}}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("negated term = %v, want %v", got, want)
+	}
+
+	got, err = parseQuery("r:rare OR is:foil set:usg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.D{{"$or", bson.A{
+		bson.D{{"$and", bson.A{bson.D{{"rarity", "rare"}}}}},
+		bson.D{{"$and", bson.A{foil, bson.D{{"set", "usg"}}}}},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("or groups = %v, want %v", got, want)
+	}
+
+	for _, query := range []string{`a:"Rebecca`, "or bolt", "bolt or", "foo:bar", "t<creature", "o:"} {
+		if got, err := parseQuery(query); err == nil {
+			t.Errorf("parseQuery(%q) = %v, want error", query, got)
+		}
+	}
+}
+
+func TestColorFilter(t *testing.T) {
+	wu := []string{"W", "U"}
+	tests := []struct {
+		name   string
+		colors []string
+		mode   string
+		want   bson.D
+	}{
+		{"exact", wu, ColorExact, bson.D{{"ci", bson.D{{"$all", wu}, {"$size", 2}}}}},
+		{"includes", wu, ColorIncludes, bson.D{{"ci", bson.D{{"$all", wu}}}}},
+		{"within", wu, ColorWithin, bson.D{{"ci", bson.D{{"$not", bson.D{{"$elemMatch", bson.D{{"$nin", wu}}}}}}}}},
+		{"colorless includes", []string{}, ColorIncludes, bson.D{{"ci", bson.D{{"$size", 0}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := colorFilter("ci", tt.colors, tt.mode); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("colorFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
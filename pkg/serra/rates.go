@@ -0,0 +1,293 @@
+package serra
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	ratesCmd.AddCommand(ratesImportCmd)
+	ratesCmd.AddCommand(ratesShowCmd)
+	rootCmd.AddCommand(ratesCmd)
+}
+
+var ratesCmd = &cobra.Command{
+	Use:   "rates",
+	Short: "Manage exchange rates to show values in other currencies",
+	Long: `Scryfall only knows prices in USD and EUR. To show values in other
+currencies like GBP or CHF, import exchange rates of the ECB (Euro foreign
+exchange reference rates) as CSV or XML, i.e.
+
+  https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.zip
+  https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml
+
+Values are converted with the rate of the day they were recorded.`,
+}
+
+var ratesImportCmd = &cobra.Command{
+	Use:           "import <file>",
+	Short:         "Import exchange rates from an ECB CSV or XML file",
+	Args:          cobra.ExactArgs(1),
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		table, err := readRates(f)
+		if err != nil {
+			return fmt.Errorf("Could not read rates from %s: %w", args[0], err)
+		}
+		if len(table) == 0 {
+			return fmt.Errorf("No rates found in %s", args[0])
+		}
+
+		// the configured currency may need the rates about to be imported
+		client, err := newClient(WithoutValuationCheck())
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.ratesCollection().storageAddRates(table); err != nil {
+			return err
+		}
+		fmt.Printf("%sImported rates of %d days (%s to %s)%s\n", Green, len(table), table[0].Date.Time().Format("2006-01-02"), table[len(table)-1].Date.Time().Format("2006-01-02"), Reset)
+		return nil
+	},
+}
+
+var ratesShowCmd = &cobra.Command{
+	Use:           "show",
+	Short:         "Show the latest exchange rates",
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		latest := client.rates.latest()
+		if latest.Rates == nil {
+			return fmt.Errorf("No rates imported yet, see serra rates import --help")
+		}
+		return render(latest, func() { showRates(latest) })
+	},
+}
+
+// Rates are the exchange rates of a day relative to EUR, like the reference
+// rates of the ECB
+type Rates struct {
+	Date  primitive.DateTime `bson:"date" json:"date" yaml:"date"`
+	Rates map[string]float64 `bson:"rates" json:"rates" yaml:"rates"`
+}
+
+// Returns the amount of currency worth one EUR
+func (r Rates) rate(currency string) (float64, bool) {
+	if currency == "EUR" {
+		return 1, true
+	}
+	rate, ok := r.Rates[currency]
+	return rate, ok && rate > 0
+}
+
+func (r Rates) Header() []string {
+	return []string{"date", "currency", "rate"}
+}
+
+func (r Rates) Rows() [][]string {
+	rows := [][]string{}
+	for _, c := range r.currencies() {
+		rows = append(rows, []string{r.Date.Time().Format("2006-01-02"), c, formatFloat(r.Rates[c])})
+	}
+	return rows
+}
+
+func (r Rates) currencies() []string {
+	currencies := []string{}
+	for c := range r.Rates {
+		currencies = append(currencies, c)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+func showRates(r Rates) {
+	fmt.Printf("%sRates of %s%s (1 EUR)\n", Green, r.Date.Time().Format("2006-01-02"), Reset)
+	for _, c := range r.currencies() {
+		fmt.Printf("* %s %s%.4f%s\n", c, Yellow, r.Rates[c], Reset)
+	}
+}
+
+// RateTable holds the rates of all days, ordered by date
+type RateTable []Rates
+
+// at returns the rates of the last day at or before date. Dates before the
+// first day use the first day, a zero date (cards not updated yet) the
+// latest day.
+func (t RateTable) at(date primitive.DateTime) Rates {
+	if len(t) == 0 {
+		return Rates{}
+	}
+	if date == 0 {
+		return t[len(t)-1]
+	}
+	i := sort.Search(len(t), func(i int) bool { return t[i].Date > date })
+	if i == 0 {
+		return t[0]
+	}
+	return t[i-1]
+}
+
+func (t RateTable) latest() Rates {
+	return t.at(0)
+}
+
+// exchange converts an amount from one currency into another
+func (r Rates) exchange(amount float64, from, to string) (float64, bool) {
+	factor, ok := r.factor(from, to)
+	return amount * factor, ok
+}
+
+// exchangeExpr converts a storage expression from one currency into another
+func (r Rates) exchangeExpr(value interface{}, from, to string) (interface{}, bool) {
+	factor, ok := r.factor(from, to)
+	if !ok {
+		return nil, false
+	}
+	if factor == 1 {
+		return value, true
+	}
+	return bson.D{{"$multiply", bson.A{value, factor}}}, true
+}
+
+// factor returns the amount of to worth one from
+func (r Rates) factor(from, to string) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	rateFrom, ok := r.rate(from)
+	if !ok {
+		return 0, false
+	}
+	rateTo, ok := r.rate(to)
+	if !ok {
+		return 0, false
+	}
+	return rateTo / rateFrom, true
+}
+
+// readRates reads the rates of an ECB CSV or XML file
+func readRates(r io.Reader) (RateTable, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var table RateTable
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		table, err = readRatesXML(data)
+	} else {
+		table, err = readRatesCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(table, func(i, j int) bool { return table[i].Date < table[j].Date })
+	return table, nil
+}
+
+// readRatesCSV reads rates like
+//
+//	Date,USD,JPY,GBP,
+//	2024-01-02,1.0956,155.52,0.86518,
+func readRatesCSV(data []byte) (RateTable, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	table := RateTable{}
+	for _, record := range records[1:] {
+		day, err := parseRateDate(record[0])
+		if err != nil {
+			return nil, err
+		}
+		rates := Rates{Date: day, Rates: map[string]float64{}}
+		for i := 1; i < len(record) && i < len(header); i++ {
+			currency := strings.TrimSpace(header[i])
+			// currencies without a rate of the day are N/A
+			rate, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64)
+			if currency == "" || err != nil {
+				continue
+			}
+			rates.Rates[currency] = rate
+		}
+		table = append(table, rates)
+	}
+	return table, nil
+}
+
+// readRatesXML reads rates like
+//
+//	<Cube time="2024-01-02"><Cube currency="USD" rate="1.0956"/></Cube>
+func readRatesXML(data []byte) (RateTable, error) {
+	var envelope struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube>Cube"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	table := RateTable{}
+	for _, d := range envelope.Days {
+		day, err := parseRateDate(d.Time)
+		if err != nil {
+			return nil, err
+		}
+		rates := Rates{Date: day, Rates: map[string]float64{}}
+		for _, r := range d.Rates {
+			rates.Rates[r.Currency] = r.Rate
+		}
+		table = append(table, rates)
+	}
+	return table, nil
+}
+
+func parseRateDate(s string) (primitive.DateTime, error) {
+	day, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid date %q", s)
+	}
+	return primitive.NewDateTimeFromTime(day), nil
+}
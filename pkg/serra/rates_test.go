@@ -0,0 +1,75 @@
+package serra
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func rateDay(s string) primitive.DateTime {
+	day, _ := time.Parse("2006-01-02", s)
+	return primitive.NewDateTimeFromTime(day)
+}
+
+func TestReadRatesCSV(t *testing.T) {
+	// currencies without a rate of the day are N/A or empty
+	csv := "Date, USD, CYP, JPY,\n2024-01-02, 1.0956, N/A, ,\n"
+
+	got, err := readRatesCSV([]byte(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RateTable{{Date: rateDay("2024-01-02"), Rates: map[string]float64{"USD": 1.0956}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readRatesCSV() = %v, want %v", got, want)
+	}
+
+	if got, err := readRatesCSV([]byte("Date,USD\n02.01.2024,1.0956\n")); err == nil {
+		t.Errorf("readRatesCSV() = %v, want error for an invalid date", got)
+	}
+}
+
+const ecbXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2024-01-03">
+			<Cube currency="USD" rate="1.0919"/>
+			<Cube currency="GBP" rate="0.8618"/>
+		</Cube>
+		<Cube time="2024-01-02">
+			<Cube currency="USD" rate="1.0956"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestReadRatesXML(t *testing.T) {
+	got, err := readRatesXML([]byte(ecbXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RateTable{
+		{Date: rateDay("2024-01-03"), Rates: map[string]float64{"USD": 1.0919, "GBP": 0.8618}},
+		{Date: rateDay("2024-01-02"), Rates: map[string]float64{"USD": 1.0956}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readRatesXML() = %v, want %v", got, want)
+	}
+}
+
+func TestReadRatesSorted(t *testing.T) {
+	// the ECB lists the latest day first, the table is sorted by date
+	table, err := readRates(strings.NewReader("\n" + ecbXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != 2 || table[0].Date != rateDay("2024-01-02") || table[1].Date != rateDay("2024-01-03") {
+		t.Errorf("readRates() = %v, want the days in ascending order", table)
+	}
+	if r := table.latest(); r.Date != rateDay("2024-01-03") {
+		t.Errorf("latest() = %v, want rates of 2024-01-03", r)
+	}
+}
@@ -6,14 +6,15 @@ import (
 
 	"github.com/chzyer/readline"
 	"github.com/spf13/cobra"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func init() {
 	removeCmd.Flags().Int64VarP(&count, "count", "c", 1, "Amount of cards to remove")
 	removeCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Spin up interactive terminal")
+	removeCmd.Flags().StringVar(&file, "file", "", "Read cards from a file, one per line (- for stdin)")
 	removeCmd.Flags().StringVarP(&set, "set", "s", "", "Filter by set code (usg/mmq/vow)")
 	removeCmd.Flags().BoolVarP(&foil, "foil", "f", false, "Remove foil variant of card")
+	removeCmd.Flags().Float64Var(&confirmValue, "confirm-value", 10, "Ask before removing cards worth more than this in interactive mode")
 	rootCmd.AddCommand(removeCmd)
 }
 
@@ -21,95 +22,133 @@ var removeCmd = &cobra.Command{
 	Aliases:       []string{"a"},
 	Use:           "remove",
 	Short:         "Remove a card from your collection",
-	Long:          "Removes a card from your collection. Amount can be modified using flags",
+	Long:          "Removes a card from your collection. Cards are given as set/collector number (usg/13) or by name (\"Lightning Bolt\"). Use - or --file to read cards line by line. Amount can be modified using flags",
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, cards []string) error {
 
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
 		if interactive {
-			removeCardsInteractive(unique, set)
-		} else {
-			removeCards(cards, count)
+			return client.removeCardsInteractive(set, confirmValue)
 		}
-		return nil
+		if input := bulkInput(cards); input != "" {
+			return client.runBulk(input, "Removed", client.removeBulk)
+		}
+		_, err = client.removeCards(cards, set, count, foilFinish(foil), nil)
+		return err
 	},
 }
 
-func removeCardsInteractive(unique bool, set string) {
-	l := Logger()
-
+func (client *Client) removeCardsInteractive(set string, threshold float64) error {
 	if len(set) == 0 {
-		l.Fatal("Option --set must be given in interactive mode")
+		return fmt.Errorf("Option --set must be given in interactive mode")
 	}
 
-	rl, err := readline.New(fmt.Sprintf("%s> ", set))
+	session, err := client.runPrompt(set, lookupLocal, func(rl *readline.Instance, cards []string, entry *PromptEntry) []CardChange {
+		// ask before removing valuable cards
+		confirm := func(c *Card, amount int64) bool {
+			value := client.valuation().cardFinishValue(*c, entry.Finish) * float64(amount)
+			if value <= threshold {
+				return true
+			}
+			answer, err := askReadline(rl)(fmt.Sprintf("Remove %dx \"%s\" worth %.2f%s? [y/N] ", amount, c.Name, value, client.currencySymbol()))
+			return err == nil && strings.ToLower(strings.TrimSpace(answer)) == "y"
+		}
+
+		changes, _ := client.removeCards(cards, set, entry.Count, entry.Finish, confirm)
+		return changes
+	})
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer rl.Close()
 
-	for {
-		line, err := rl.Readline()
-		if err != nil { // io.EOF
-			break
-		}
+	total, value := session.summary(client.valuation())
+	fmt.Printf("\n%sRemoved %d cards worth %s%.2f%s%s in this session\n", Green, -total, Yellow, -value, client.currencySymbol(), Reset)
+	return nil
+}
 
-		// construct card input for addCards
-		card := []string{}
-		card = append(card, fmt.Sprintf("%s/%s", set, strings.TrimSpace(line)))
+// removeCards removes an amount of cards in a finish and returns what was
+// removed. Cards given by name are looked up within set, if it is not empty.
+// If confirm is given, it is asked before each removal.
+func (client *Client) removeCards(cards []string, set string, count int64, finish string, confirm func(*Card, int64) bool) ([]CardChange, error) {
+	l := Logger()
 
-		removeCards(card, count)
+	if err := checkCount(count); err != nil {
+		return nil, err
 	}
 
-}
+	// cards given by name are looked up in the collection
+	cards = client.resolveCards(cards, set, lookupLocal)
 
-func removeCards(cards []string, count int64) error {
-	// Connect to the DB & load the collection
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
-	l := Logger()
-	defer storageDisconnect(client)
+	changes := []CardChange{}
 
 	// Loop over different cards
 	for _, card := range cards {
 
-		if !strings.Contains(card, "/") {
+		if !isCardID(card) {
 			l.Errorf("Invalid card format %s. Needs to be set/collector number i.e. \"usg/13\"", card)
 			continue
 		}
 
 		// Extract collector number and set name from input & remove leading zeros
 		collectorNumber := strings.TrimLeft(strings.Split(card, "/")[1], "0")
-		setName := strings.Split(card, "/")[0]
+		setName := strings.ToLower(strings.Split(card, "/")[0])
 
 		if collectorNumber == "" {
 			l.Errorf("Invalid card format %s. Needs to be set/collector number i.e. \"usg/13\"", card)
 			continue
 		}
 
-		// Fetch card from scryfall
-		c, err := findCardByCollectorNumber(coll, setName, collectorNumber)
+		change, err := client.removeCard(setName, collectorNumber, count, finish, confirm)
 		if err != nil {
 			l.Error(err)
 			continue
 		}
-
-		if foil && c.SerraCountFoil < 1 {
-			l.Errorf("No foil \"%s\" in the collection", c.Name)
-			continue
+		if change != nil {
+			changes = append(changes, *change)
 		}
+	}
 
-		if !foil && c.SerraCount < 1 {
-			l.Errorf("No normal \"%s\" in the collection", c.Name)
-			continue
-		}
+	return changes, nil
+}
 
-		if foil && c.SerraCountFoil == 1 && c.SerraCount == 0 || !foil && c.SerraCount == 1 && c.SerraCountFoil == 0 {
-			coll.storageRemove(bson.M{"_id": c.ID})
-			l.Infof("\"%s\" (%.2f%s) removed", c.Name, c.getValue(foil), getCurrency())
-		} else {
-			modifyCardCount(coll, c, -count, foil)
-		}
+// removeCard removes an amount of a single card in a finish. Nothing is
+// returned if the removal was not confirmed.
+func (client *Client) removeCard(setName, collectorNumber string, count int64, finish string, confirm func(*Card, int64) bool) (*CardChange, error) {
+	l := Logger()
+	coll := client.cards()
+	v := client.valuation()
+
+	c, err := findCardByCollectorNumber(coll, setName, collectorNumber)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	owned := c.getCount(finish)
+	if owned < 1 {
+		return nil, fmt.Errorf("No %s \"%s\" in the collection", finish, c.Name)
+	}
+
+	if owned < count {
+		return nil, fmt.Errorf("Only %d %s \"%s\" in the collection", owned, finish, c.Name)
+	}
+
+	if confirm != nil && !confirm(c, count) {
+		l.Warnf("\"%s\" not removed", c.Name)
+		return nil, nil
+	}
+
+	deleted, err := modifyCardCount(coll, v, c, -count, finish)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		l.Infof("\"%s\" (%.2f%s) removed", c.Name, v.cardFinishValue(*c, finish), v.symbol())
+		return &CardChange{Card: *c, Finish: finish, Amount: -count, Deleted: true}, nil
+	}
+	return &CardChange{Card: *c, Finish: finish, Amount: -count}, nil
 }
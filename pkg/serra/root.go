@@ -7,26 +7,59 @@ import (
 var (
 	Version         = "unknown"
 	address         string
+	addedAfter      string
+	addedBefore     string
+	all             bool
 	artist          string
+	banned          string
+	cardmarketFile  string
 	cardType        string
+	collection      string
 	color           string
+	colorMode       string
+	confirmValue    float64
 	cmc             int64
 	count           int64
 	detail          bool
+	file            string
+	finish          string
 	foil            bool
+	foilOnly        bool
 	format          string
+	fromFinish      string
+	gainsSort       string
 	interactive     bool
+	legal           string
 	limit           float64
+	maxCount        int64
+	maxValue        float64
+	minCount        int64
+	minValue        float64
+	mtgjsonFile     string
+	mtgjsonIDs      string
+	mtgjsonList     string
+	mtgjsonVendor   string
 	name            string
+	nonfoilOnly     bool
 	oracle          string
+	output          string
+	query           string
 	port            uint64
+	profile         string
 	rarity          string
+	releasedAfter   string
 	reserved        bool
+	restricted      string
 	set             string
+	setSort         string
+	since           string
 	sinceBeginning  bool
 	sinceLastUpdate bool
 	sortby          string
+	toFinish        string
+	trimMinCount    int64
 	unique          bool
+	weighted        bool
 )
 
 var rootCmd = &cobra.Command{
@@ -35,6 +68,12 @@ var rootCmd = &cobra.Command{
 	Use:                   "serra",
 	DisableFlagsInUseLine: true,
 	SilenceErrors:         true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadSettings(cmd); err != nil {
+			return err
+		}
+		return checkOutput()
+	},
 }
 
 func Execute() {
@@ -0,0 +1,63 @@
+package serra
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	rootCmd.AddCommand(rotatedCmd)
+}
+
+var rotatedCmd = &cobra.Command{
+	Use:   "rotated",
+	Short: "Display cards that rotated out of standard or pioneer",
+	Long: `Lists all cards of your collection that lost their legality in
+standard or pioneer during the last update.`,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		cards, err := client.rotatedCards()
+		if err != nil {
+			return err
+		}
+
+		list := CardList{}
+		for i := range cards {
+			o := newCardOutput(client.valuation(), &cards[i])
+			o.Rotated = lastRotations(&cards[i])
+			list = append(list, o)
+		}
+
+		return render(list, func() {
+			for _, card := range cards {
+				fmt.Printf("* %dx %s%s%s (%s/%s) %s%.2f%s%s rotated out of %s\n", card.SerraCount+card.SerraCountFoil+card.SerraCountEtched, Purple, card.Name, Reset, card.Set, card.CollectorNumber, Yellow, client.cardValue(card, false), client.currencySymbol(), Reset, strings.Join(lastRotations(&card), ", "))
+			}
+		})
+	},
+}
+
+// rotatedCards returns all cards that rotated out at their last update
+func (client *Client) rotatedCards() ([]Card, error) {
+	filter := bson.D{{"$expr", bson.D{{"$in", bson.A{"$serra_updated", bson.D{{"$ifNull", bson.A{"$serra_rotated.date", bson.A{}}}}}}}}}
+	return client.cards().storageFind(filter, bson.D{{"name", 1}}, 0, 0)
+}
+
+// lastRotations returns the formats a card rotated out of at its last update
+func lastRotations(c *Card) []string {
+	formats := []string{}
+	for _, r := range c.SerraRotated {
+		if r.Date == c.SerraUpdated {
+			formats = append(formats, r.Format)
+		}
+	}
+	return formats
+}
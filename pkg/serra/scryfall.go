@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"time"
 
@@ -20,6 +19,11 @@ type Card struct {
 	SerraPrices      []PriceEntry       `bson:"serra_prices"`
 	SerraCreated     primitive.DateTime `bson:"serra_created"`
 	SerraUpdated     primitive.DateTime `bson:"serra_updated"`
+	SerraRotated     []Rotation         `bson:"serra_rotated,omitempty"`
+
+	// prices of other providers than scryfall, by provider
+	ProviderPrices      map[string]PriceEntry   `bson:"provider_prices,omitempty" json:"-"`
+	SerraProviderPrices map[string][]PriceEntry `bson:"serra_provider_prices,omitempty" json:"-"`
 
 	Artist          string   `json:"artist"`
 	ArtistIds       []string `json:"artist_ids"`
@@ -119,18 +123,86 @@ type Card struct {
 	Variation      bool    `json:"variation"`
 }
 
-// Getter for currency specific value
-func (c Card) getValue(foil bool) float64 {
-	if getCurrency() == EUR {
-		if foil {
-			return c.Prices.EurFoil
+// Returns the amount of owned cards in the given finish
+func (c Card) getCount(finish string) int64 {
+	switch finish {
+	case FinishFoil:
+		return c.SerraCountFoil
+	case FinishEtched:
+		return c.SerraCountEtched
+	}
+	return c.SerraCount
+}
+
+type Legality struct {
+	Format string `json:"format" yaml:"format"`
+	Status string `json:"status" yaml:"status"`
+}
+
+// Returns legalities of a card as an ordered list, to be able to iterate over it
+func (c Card) LegalityList() []Legality {
+	l := c.Legalities
+	return []Legality{
+		{"standard", l.Standard},
+		{"future", l.Future},
+		{"historic", l.Historic},
+		{"gladiator", l.Gladiator},
+		{"pioneer", l.Pioneer},
+		{"modern", l.Modern},
+		{"legacy", l.Legacy},
+		{"pauper", l.Pauper},
+		{"vintage", l.Vintage},
+		{"penny", l.Penny},
+		{"commander", l.Commander},
+		{"brawl", l.Brawl},
+		{"historicbrawl", l.Historicbrawl},
+		{"alchemy", l.Alchemy},
+		{"paupercommander", l.Paupercommander},
+		{"duel", l.Duel},
+		{"oldschool", l.Oldschool},
+		{"premodern", l.Premodern},
+	}
+}
+
+// Returns the legality status of a card in a format
+func (c Card) Legality(format string) string {
+	for _, l := range c.LegalityList() {
+		if l.Format == format {
+			return l.Status
 		}
-		return c.Prices.Eur
 	}
-	if foil {
-		return c.Prices.UsdFoil
+	return ""
+}
+
+// Returns true if format is a known format of scryfall
+func isFormat(format string) bool {
+	for _, l := range (Card{}).LegalityList() {
+		if l.Format == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Rotation records when a card lost its legality in a format
+type Rotation struct {
+	Format string             `bson:"format"`
+	Date   primitive.DateTime `bson:"date"`
+}
+
+// Formats where cards rotate out regularly
+var rotatingFormats = []string{"standard", "pioneer"}
+
+// Returns the rotating formats a card has been legal in before, but is not
+// anymore in its updated version
+func rotatedFormats(old, updated *Card) []string {
+	formats := []string{}
+	for _, f := range rotatingFormats {
+		if old.Legality(f) == "legal" && updated.Legality(f) != "legal" {
+			formats = append(formats, f)
+		}
 	}
-	return c.Prices.Usd
+	return formats
 }
 
 type PriceEntry struct {
@@ -170,12 +242,27 @@ type Set struct {
 	URI          string             `json:"uri"`
 }
 
-func fetchCard(setName, collectorNumber string) (*Card, error) {
-	resp, err := http.Get(fmt.Sprintf("https://api.scryfall.com/cards/%s/%s/", setName, collectorNumber))
+// Scryfall is a client of the scryfall API
+type Scryfall struct {
+	HTTP    *http.Client
+	BaseURL string
+}
+
+// Base URL of the scryfall API
+const scryfallURL = "https://api.scryfall.com"
+
+// NewScryfall returns a client of the scryfall API using the default http
+// client
+func NewScryfall() *Scryfall {
+	return &Scryfall{HTTP: http.DefaultClient, BaseURL: scryfallURL}
+}
+
+func (s *Scryfall) fetchCard(setName, collectorNumber string) (*Card, error) {
+	resp, err := s.HTTP.Get(fmt.Sprintf("%s/cards/%s/%s/", s.BaseURL, setName, collectorNumber))
 	if err != nil {
-		log.Fatalln(err)
-		return &Card{}, err
+		return &Card{}, fmt.Errorf("Could not fetch card %s/%s: %w", setName, collectorNumber, err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		return &Card{}, fmt.Errorf("Card %s/%s not found", setName, collectorNumber)
@@ -184,8 +271,7 @@ func fetchCard(setName, collectorNumber string) (*Card, error) {
 	//We Read the response body on the line below.
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("%s", err)
-		return &Card{}, err
+		return &Card{}, fmt.Errorf("Could not read card %s/%s: %w", setName, collectorNumber, err)
 	}
 
 	r := bytes.NewReader(body)
@@ -194,26 +280,95 @@ func fetchCard(setName, collectorNumber string) (*Card, error) {
 
 	err = decoder.Decode(val)
 	if err != nil {
-		log.Fatalf("%s", err)
+		return &Card{}, fmt.Errorf("Could not decode card %s/%s: %w", setName, collectorNumber, err)
 	}
 
+	initCard(val)
+	return val, nil
+}
+
+// initCard prepares a card fetched from scryfall to be stored
+func initCard(val *Card) {
 	// Set created Time
 	val.SerraCreated = primitive.NewDateTimeFromTime(time.Now())
 
 	// Increase Price
 	val.Prices.Date = primitive.NewDateTimeFromTime(time.Now())
 	val.SerraPrices = append(val.SerraPrices, val.Prices)
+}
 
-	return val, nil
+// CardIdentifier identifies a card in a batched request, either by set and
+// collector number or by name
+type CardIdentifier struct {
+	Set             string `json:"set,omitempty"`
+	CollectorNumber string `json:"collector_number,omitempty"`
+	Name            string `json:"name,omitempty"`
+}
+
+// Maximum amount of identifiers per request to /cards/collection
+const collectionBatchSize = 75
+
+// fetchCardCollection fetches many cards with as few requests as possible.
+// The returned cards are in the order of the identifiers, cards that are not
+// found are nil.
+func (s *Scryfall) fetchCardCollection(identifiers []CardIdentifier) ([]*Card, error) {
+	cards := []*Card{}
+
+	for start := 0; start < len(identifiers); start += collectionBatchSize {
+		batch := identifiers[start:min(start+collectionBatchSize, len(identifiers))]
+
+		body, err := json.Marshal(map[string][]CardIdentifier{"identifiers": batch})
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := s.HTTP.Post(s.BaseURL+"/cards/collection", "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Batched card lookup failed with status %s", resp.Status)
+		}
+
+		result := struct {
+			Data     []Card           `json:"data"`
+			NotFound []CardIdentifier `json:"not_found"`
+		}{}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		// found cards are returned in order, without the ones not found
+		notFound := map[CardIdentifier]bool{}
+		for _, id := range result.NotFound {
+			notFound[id] = true
+		}
+		next := 0
+		for _, id := range batch {
+			if notFound[id] || next >= len(result.Data) {
+				cards = append(cards, nil)
+				continue
+			}
+			c := &result.Data[next]
+			initCard(c)
+			cards = append(cards, c)
+			next++
+		}
+	}
+
+	return cards, nil
 }
 
-func fetchSets() (*SetList, error) {
-	// TODO better URL Building...
-	resp, err := http.Get("https://api.scryfall.com/sets")
+func (s *Scryfall) fetchSets() (*SetList, error) {
+	resp, err := s.HTTP.Get(s.BaseURL + "/sets")
 	if err != nil {
-		log.Fatalln(err)
-		return &SetList{}, err
+		return &SetList{}, fmt.Errorf("Could not fetch sets: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		return &SetList{}, fmt.Errorf("/sets not found")
@@ -222,8 +377,7 @@ func fetchSets() (*SetList, error) {
 	//We Read the response body on the line below.
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalln(err)
-		return &SetList{}, err
+		return &SetList{}, fmt.Errorf("Could not read sets: %w", err)
 	}
 
 	r := bytes.NewReader(body)
@@ -232,8 +386,47 @@ func fetchSets() (*SetList, error) {
 
 	err = decoder.Decode(val)
 	if err != nil {
-		log.Fatalln(err)
+		return &SetList{}, fmt.Errorf("Could not decode sets: %w", err)
 	}
 
 	return val, nil
 }
+
+// scryfallCache fetches the list of sets and each card only once, so cards
+// shared between collections are not fetched again when updating them all
+type scryfallCache struct {
+	scryfall *Scryfall
+	sets     *SetList
+	cards    map[string]*Card
+}
+
+func newScryfallCache(s *Scryfall) *scryfallCache {
+	return &scryfallCache{scryfall: s, cards: map[string]*Card{}}
+}
+
+func (c *scryfallCache) fetchSets() (*SetList, error) {
+	if c.sets != nil {
+		return c.sets, nil
+	}
+	sets, err := c.scryfall.fetchSets()
+	if err != nil {
+		return nil, err
+	}
+	c.sets = sets
+	return sets, nil
+}
+
+func (c *scryfallCache) fetchCard(setName, collectorNumber string) (*Card, error) {
+	key := setName + "/" + collectorNumber
+	if card, ok := c.cards[key]; ok {
+		copied := *card
+		return &copied, nil
+	}
+	card, err := c.scryfall.fetchCard(setName, collectorNumber)
+	if err != nil {
+		return nil, err
+	}
+	c.cards[key] = card
+	copied := *card
+	return &copied, nil
+}
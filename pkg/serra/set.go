@@ -1,7 +1,9 @@
 package serra
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/spf13/cobra"
 	"go.mongodb.org/mongo-driver/bson"
@@ -10,7 +12,7 @@ import (
 )
 
 func init() {
-	setCmd.Flags().StringVarP(&sortby, "sort", "s", "release", "How to sort cards (release/value)")
+	setCmd.Flags().StringVarP(&setSort, "sort", "s", "release", "How to sort cards (release/value)")
 	rootCmd.AddCommand(setCmd)
 }
 
@@ -23,29 +25,43 @@ If you directly put a setcode as an argument, it will be displayed
 otherwise you'll get a list of sets as a search result.`,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, set []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
 		if len(set) == 0 {
-			setList := Sets(sortby)
-			showSetList(setList)
-		} else {
-			ShowSet(set[0])
+			setList, err := client.Sets(setSort)
+			if err != nil {
+				return err
+			}
+			return render(setList, func() { showSetList(client.valuation(), setList) })
 		}
-		return nil
+		return client.showSet(set[0])
 	},
 }
 
-func Sets(sort string) []primitive.M {
+// aggregateSets sums up count and value of the cards of each set
+func (client *Client) aggregateSets(sort string) ([]primitive.M, error) {
 
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
-	defer storageDisconnect(client)
+	coll := client.cards()
 
 	groupStage := bson.D{
 		{"$group", bson.D{
 			{"_id", "$setname"},
-			{"value", bson.D{{"$sum", bson.D{{"$multiply", bson.A{getCurrencyField(false), "$serra_count"}}}}}},
-			{"value_foil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{getCurrencyField(true), "$serra_count_foil"}}}}}},
-			{"count", bson.D{{"$sum", bson.D{{"$multiply", bson.A{1.0, "$serra_count"}}}}}},
+			{"value", bson.D{{"$sum", bson.D{{"$add", bson.A{
+				valueExpr(client.priceField(false), "$serra_count"),
+				valueExpr(client.priceField(true), "$serra_count_foil"),
+				valueExpr(client.finishPriceField(FinishEtched), etchedCount),
+			}}}}}},
+			{"count", bson.D{{"$sum", bson.D{{"$add", bson.A{"$serra_count", "$serra_count_foil", etchedCount}}}}}},
 			{"unique", bson.D{{"$sum", 1}}},
+			{"unpriced", bson.D{{"$sum", bson.D{{"$add", bson.A{
+				unpricedExpr(client.priceField(false), "$serra_count"),
+				unpricedExpr(client.priceField(true), "$serra_count_foil"),
+				unpricedExpr(client.finishPriceField(FinishEtched), etchedCount),
+			}}}}}},
 			{"code", bson.D{{"$last", "$set"}}},
 			{"release", bson.D{{"$last", "$releasedat"}}},
 		}},
@@ -65,46 +81,181 @@ func Sets(sort string) []primitive.M {
 			}}}
 	}
 
-	sets, _ := coll.storageAggregate(mongo.Pipeline{groupStage, sortStage})
-	return sets
+	return coll.storageAggregate(mongo.Pipeline{groupStage, sortStage})
+
+}
 
+// SetSummary is a single set of the collection in the list of sets
+type SetSummary struct {
+	Name      string  `json:"name" yaml:"name"`
+	Code      string  `json:"code" yaml:"code"`
+	Release   string  `json:"release" yaml:"release"`
+	Unique    int64   `json:"unique" yaml:"unique"`
+	CardCount int64   `json:"card_count" yaml:"card_count"`
+	Count     float64 `json:"count" yaml:"count"`
+	Value     float64 `json:"value" yaml:"value"`
+	Currency  string  `json:"currency" yaml:"currency"`
+	Unpriced  float64 `json:"unpriced" yaml:"unpriced"`
 }
 
-func showSetList(sets []primitive.M) {
+// SetSummaries is a list of sets that can be written as csv
+type SetSummaries []SetSummary
 
-	client := storageConnect()
-	setscoll := &Collection{client.Database("serra").Collection("sets")}
+func (l SetSummaries) Header() []string {
+	return []string{"name", "code", "release", "unique", "card_count", "count", "value", "currency", "unpriced"}
+}
+
+func (l SetSummaries) Rows() [][]string {
+	rows := [][]string{}
+	for _, s := range l {
+		rows = append(rows, []string{s.Name, s.Code, s.Release, strconv.FormatInt(s.Unique, 10), strconv.FormatInt(s.CardCount, 10), fmt.Sprintf("%.0f", s.Count), formatFloat(s.Value), s.Currency, fmt.Sprintf("%.0f", s.Unpriced)})
+	}
+	return rows
+}
+
+// setSummaries completes the aggregated sets with the set informations
+func (client *Client) setSummaries(sets []primitive.M) (SetSummaries, error) {
+
+	setscoll := client.sets()
+
+	summaries := SetSummaries{}
+	for _, set := range sets {
+		// sets are only known after the first update
+		setobj, err := findSetByCode(setscoll, set["code"].(string))
+		if err != nil && !errors.Is(err, errSetNotFound) {
+			return nil, err
+		}
+		s := SetSummary{
+			Name:      set["_id"].(string),
+			Code:      set["code"].(string),
+			Release:   set["release"].(string),
+			CardCount: setobj.CardCount,
+			Currency:  client.currency,
+		}
+		unique, _ := getFloat64(set["unique"])
+		s.Unique = int64(unique)
+		s.Count, _ = getFloat64(set["count"])
+		s.Value, _ = getFloat64(set["value"])
+		s.Unpriced, _ = getFloat64(set["unpriced"])
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
 
+func showSetList(v valuation, sets SetSummaries) {
 	for _, set := range sets {
-		setobj, _ := findSetByCode(setscoll, set["code"].(string))
-		fmt.Printf("* %s %s%s%s (%s%s%s)\n", set["release"].(string)[0:4], Purple, set["_id"], Reset, Cyan, set["code"], Reset)
-		fmt.Printf("  Cards: %s%d/%d%s Total: %.0f \n", Yellow, set["unique"], setobj.CardCount, Reset, set["count"])
-		fmt.Printf("  Value: %s%.2f%s%s\n", Pink, set["value"], getCurrency(), Reset)
+		fmt.Printf("* %s %s%s%s (%s%s%s)\n", set.Release[0:4], Purple, set.Name, Reset, Cyan, set.Code, Reset)
+		fmt.Printf("  Cards: %s%d/%d%s Total: %.0f \n", Yellow, set.Unique, set.CardCount, Reset, set.Count)
+		fmt.Printf("  Value: %s%.2f%s%s\n", Pink, set.Value, v.symbol(), Reset)
+		if set.Unpriced > 0 {
+			fmt.Printf("  Unpriced: %.0f\n", set.Unpriced)
+		}
 		fmt.Println()
 	}
 }
 
-func ShowSet(setname string) error {
+// SetDetails holds everything known about a single set in the collection
+type SetDetails struct {
+	Set         Set
+	Cards       []Card
+	Count       float64
+	CountFoil   float64
+	CountEtched float64
+	Value       float64
+	ValueFoil   float64
+	ValueEtched float64
+	Unpriced    float64
+	Rarities    Rarities
+}
+
+// Returns the percentage of unique set cards owned
+func (s SetDetails) Completion() float64 {
+	if s.Set.CardCount == 0 {
+		return 0
+	}
+	return float64(len(s.Cards)) / float64(s.Set.CardCount) * 100
+}
+
+// Returns the most valuable cards of the set, at most n
+func (s SetDetails) MostValuable(n int) []Card {
+	if len(s.Cards) < n {
+		return s.Cards
+	}
+	return s.Cards[:n]
+}
+
+// SetDetailsOutput is the machine readable representation of a set
+type SetDetailsOutput struct {
+	Name         string       `json:"name" yaml:"name"`
+	Code         string       `json:"code" yaml:"code"`
+	Released     string       `json:"released" yaml:"released"`
+	Unique       int          `json:"unique" yaml:"unique"`
+	CardCount    int64        `json:"card_count" yaml:"card_count"`
+	Count        float64      `json:"count" yaml:"count"`
+	CountFoil    float64      `json:"count_foil" yaml:"count_foil"`
+	CountEtched  float64      `json:"count_etched" yaml:"count_etched"`
+	Value        float64      `json:"value" yaml:"value"`
+	ValueFoil    float64      `json:"value_foil" yaml:"value_foil"`
+	ValueEtched  float64      `json:"value_etched" yaml:"value_etched"`
+	Unpriced     float64      `json:"unpriced" yaml:"unpriced"`
+	Currency     string       `json:"currency" yaml:"currency"`
+	Rarities     Rarities     `json:"rarities" yaml:"rarities"`
+	History      []PricePoint `json:"history" yaml:"history"`
+	MostValuable CardList     `json:"most_valuable" yaml:"most_valuable"`
+	cards        CardList
+}
+
+// Header and Rows write all owned cards of the set as csv
+func (s SetDetailsOutput) Header() []string {
+	return s.cards.Header()
+}
+
+func (s SetDetailsOutput) Rows() [][]string {
+	return s.cards.Rows()
+}
 
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
+func newSetDetailsOutput(v valuation, d *SetDetails) SetDetailsOutput {
+	return SetDetailsOutput{
+		Name:         d.Set.Name,
+		Code:         d.Set.Code,
+		Released:     d.Set.ReleasedAt,
+		Unique:       len(d.Cards),
+		CardCount:    d.Set.CardCount,
+		Count:        d.Count,
+		CountFoil:    d.CountFoil,
+		CountEtched:  d.CountEtched,
+		Value:        d.Value,
+		ValueFoil:    d.ValueFoil,
+		ValueEtched:  d.ValueEtched,
+		Unpriced:     d.Unpriced,
+		Currency:     v.currency,
+		Rarities:     d.Rarities,
+		History:      newPriceHistory(v, d.Set.SerraPrices),
+		MostValuable: newCardList(v, d.MostValuable(10)),
+		cards:        newCardList(v, d.Cards),
+	}
+}
+
+func (client *Client) setDetails(setname string) (*SetDetails, error) {
+
+	coll := client.cards()
 	l := Logger()
-	defer storageDisconnect(client)
 
 	// fetch all cards in set ordered by currently used currency
-	cardSortCurrency := bson.D{{"prices.usd", -1}}
-	if getCurrency() == EUR {
-		cardSortCurrency = bson.D{{"prices.eur", -1}}
-	}
+	cardSortCurrency := bson.D{{client.sortField(false), -1}}
 	cards, err := coll.storageFind(bson.D{{"set", setname}}, cardSortCurrency, 0, 0)
-	if (err != nil) || len(cards) == 0 {
-		l.Errorf("Set %s not found or no card in your collection.", setname)
-		return err
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("Set %s not found or no card in your collection.", setname)
 	}
 
 	// fetch set informations
-	setcoll := &Collection{client.Database("serra").Collection("sets")}
-	sets, _ := setcoll.storageFindSet(bson.D{{"code", setname}}, bson.D{{"_id", 1}})
+	set, err := findSetByCode(client.sets(), setname)
+	if err != nil {
+		return nil, err
+	}
 
 	// set values
 	matchStage := bson.D{
@@ -115,13 +266,23 @@ func ShowSet(setname string) error {
 	groupStage := bson.D{
 		{"$group", bson.D{
 			{"_id", "$setname"},
-			{"value", bson.D{{"$sum", bson.D{{"$multiply", bson.A{getCurrencyField(false), "$serra_count"}}}}}},
-			{"value_foil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{getCurrencyField(true), "$serra_count_foil"}}}}}},
+			{"value", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.priceField(false), "$serra_count"}}}}}},
+			{"value_foil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.priceField(true), "$serra_count_foil"}}}}}},
+			{"value_etched", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.finishPriceField(FinishEtched), etchedCount}}}}}},
 			{"count", bson.D{{"$sum", bson.D{{"$multiply", bson.A{1.0, "$serra_count"}}}}}},
 			{"count_foil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{1.0, "$serra_count_foil"}}}}}},
+			{"count_etched", bson.D{{"$sum", bson.D{{"$multiply", bson.A{1.0, etchedCount}}}}}},
+			{"unpriced", bson.D{{"$sum", bson.D{{"$add", bson.A{
+				unpricedExpr(client.priceField(false), "$serra_count"),
+				unpricedExpr(client.priceField(true), "$serra_count_foil"),
+				unpricedExpr(client.finishPriceField(FinishEtched), etchedCount),
+			}}}}}},
 		}},
 	}
-	stats, _ := coll.storageAggregate(mongo.Pipeline{matchStage, groupStage})
+	stats, err := coll.storageAggregate(mongo.Pipeline{matchStage, groupStage})
+	if err != nil {
+		return nil, err
+	}
 
 	// set rarities
 	matchStage = bson.D{
@@ -139,59 +300,75 @@ func ShowSet(setname string) error {
 		{"$sort", bson.D{
 			{"_id", 1},
 		}}}
-	rar, _ := coll.storageAggregate(mongo.Pipeline{matchStage, groupStage, sortStage})
-
-	ri := convertRarities(rar)
+	rar, err := coll.storageAggregate(mongo.Pipeline{matchStage, groupStage, sortStage})
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Printf("%s%s%s\n", Green, sets[0].Name, Reset)
-	fmt.Printf("Released: %s\n", sets[0].ReleasedAt)
-	fmt.Printf("Set Cards: %d/%d\n", len(cards), sets[0].CardCount)
-	fmt.Printf("Total Cards: %.0f\n", stats[0]["count"])
-	fmt.Printf("Foil Cards: %.0f\n", stats[0]["count_foil"])
+	details := &SetDetails{
+		Set:      *set,
+		Cards:    cards,
+		Rarities: convertRarities(rar),
+	}
 
-	normalValue, err := getFloat64(stats[0]["value"])
+	details.Value, err = getFloat64(stats[0]["value"])
+	if err != nil {
+		l.Error(err)
+	}
+	details.ValueFoil, err = getFloat64(stats[0]["value_foil"])
+	if err != nil {
+		l.Error(err)
+	}
+	details.ValueEtched, err = getFloat64(stats[0]["value_etched"])
 	if err != nil {
 		l.Error(err)
-		normalValue = 0
 	}
-	foilValue, err := getFloat64(stats[0]["value_foil"])
+	details.Count, _ = getFloat64(stats[0]["count"])
+	details.CountFoil, _ = getFloat64(stats[0]["count_foil"])
+	details.CountEtched, _ = getFloat64(stats[0]["count_etched"])
+	details.Unpriced, _ = getFloat64(stats[0]["unpriced"])
+
+	return details, nil
+}
+
+func (client *Client) showSet(setname string) error {
+	l := Logger()
+
+	details, err := client.setDetails(setname)
 	if err != nil {
 		l.Error(err)
-		foilValue = 0
+		return err
 	}
-	totalValue := normalValue + foilValue
 
-	normalCount, _ := getFloat64(stats[0]["count"])
-	foilCount, _ := getFloat64(stats[0]["count_foil"])
+	return render(newSetDetailsOutput(client.valuation(), details), func() { showSetDetails(client.valuation(), details) })
+}
+
+func showSetDetails(v valuation, details *SetDetails) {
+	fmt.Printf("%s%s%s\n", Green, details.Set.Name, Reset)
+	fmt.Printf("Released: %s\n", details.Set.ReleasedAt)
+	fmt.Printf("Set Cards: %d/%d\n", len(details.Cards), details.Set.CardCount)
+	fmt.Printf("Total Cards: %.0f\n", details.Count)
+	fmt.Printf("Foil Cards: %.0f\n", details.CountFoil)
+	fmt.Printf("Etched Cards: %.0f\n", details.CountEtched)
 
 	fmt.Printf("\n%sCurrent Value%s\n", Purple, Reset)
-	fmt.Printf("Total: %.0fx %s%.2f%s%s\n", normalCount+foilCount, Yellow, totalValue, getCurrency(), Reset)
-	fmt.Printf("Normal: %.0fx %s%.2f%s%s\n", stats[0]["count"], Yellow, normalValue, getCurrency(), Reset)
-	fmt.Printf("Foil: %.0fx %s%.2f%s%s\n", stats[0]["count_foil"], Yellow, foilValue, getCurrency(), Reset)
+	fmt.Printf("Total: %.0fx %s%.2f%s%s\n", details.Count+details.CountFoil+details.CountEtched, Yellow, details.Value+details.ValueFoil+details.ValueEtched, v.symbol(), Reset)
+	fmt.Printf("Normal: %.0fx %s%.2f%s%s\n", details.Count, Yellow, details.Value, v.symbol(), Reset)
+	fmt.Printf("Foil: %.0fx %s%.2f%s%s\n", details.CountFoil, Yellow, details.ValueFoil, v.symbol(), Reset)
+	fmt.Printf("Etched: %.0fx %s%.2f%s%s\n", details.CountEtched, Yellow, details.ValueEtched, v.symbol(), Reset)
+	fmt.Printf("Unpriced: %.0fx\n", details.Unpriced)
 
 	fmt.Printf("\n%sRarities%s\n", Purple, Reset)
-	fmt.Printf("Mythics: %.0f\n", ri.Mythics)
-	fmt.Printf("Rares: %.0f\n", ri.Rares)
-	fmt.Printf("Uncommons: %.0f\n", ri.Uncommons)
-	fmt.Printf("Commons: %.0f\n", ri.Commons)
+	fmt.Printf("Mythics: %.0f\n", details.Rarities.Mythics)
+	fmt.Printf("Rares: %.0f\n", details.Rarities.Rares)
+	fmt.Printf("Uncommons: %.0f\n", details.Rarities.Uncommons)
+	fmt.Printf("Commons: %.0f\n", details.Rarities.Commons)
 
 	fmt.Printf("\n%sPrice History:%s\n", Pink, Reset)
-	showPriceHistory(sets[0].SerraPrices, "* ", true)
+	showPriceHistory(v, details.Set.SerraPrices, "* ", true)
 
 	fmt.Printf("\n%sMost valuable cards%s\n", Pink, Reset)
-
-	// Calc counter to show 10 cards or less
-	ccards := 0
-	if len(cards) < 10 {
-		ccards = len(cards)
-	} else {
-		ccards = 10
-	}
-
-	for i := 0; i < ccards; i++ {
-		card := cards[i]
-		fmt.Printf("* %s%s%s (%s/%s) %s%.2f%s%s\n", Purple, card.Name, Reset, sets[0].Code, card.CollectorNumber, Yellow, card.getValue(false), getCurrency(), Reset)
+	for _, card := range details.MostValuable(10) {
+		fmt.Printf("* %s%s%s (%s/%s) %s%.2f%s%s\n", Purple, card.Name, Reset, details.Set.Code, card.CollectorNumber, Yellow, v.cardValue(card, false), v.symbol(), Reset)
 	}
-
-	return nil
 }
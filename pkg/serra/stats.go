@@ -20,96 +20,245 @@ var statsCmd = &cobra.Command{
 	Short:         "Shows statistics of the collection",
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		Stats()
-		return nil
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		stats, err := client.stats()
+		if err != nil {
+			return err
+		}
+		return render(stats, func() { showStats(client.valuation(), stats) })
 	},
 }
 
-func Stats() {
-	client := storageConnect()
-	coll := &Collection{client.Database("serra").Collection("cards")}
-	totalcoll := &Collection{client.Database("serra").Collection("total")}
-	defer storageDisconnect(client)
+// StatsEntry is a single labeled number of a statistic, i.e. an artist and
+// the amount of cards drawn by the artist
+type StatsEntry struct {
+	Name  string  `json:"name" yaml:"name"`
+	Count float64 `json:"count" yaml:"count"`
+}
+
+// FormatStats counts the owned cards legal in a format and their value
+type FormatStats struct {
+	Format string  `json:"format" yaml:"format"`
+	Count  float64 `json:"count" yaml:"count"`
+	Value  float64 `json:"value" yaml:"value"`
+}
+
+// CollectionStats holds all statistics calculated over the collection. It is
+// used by the command line as well as the web interface.
+type CollectionStats struct {
+	Count         float64       `json:"count" yaml:"count"`
+	CountFoil     float64       `json:"count_foil" yaml:"count_foil"`
+	CountEtched   float64       `json:"count_etched" yaml:"count_etched"`
+	CountAll      float64       `json:"count_all" yaml:"count_all"`
+	Unique        float64       `json:"unique" yaml:"unique"`
+	Unpriced      float64       `json:"unpriced" yaml:"unpriced"`
+	Value         float64       `json:"value" yaml:"value"`
+	ValueFoil     float64       `json:"value_foil" yaml:"value_foil"`
+	ValueEtched   float64       `json:"value_etched" yaml:"value_etched"`
+	Currency      string        `json:"currency" yaml:"currency"`
+	Reserved      float64       `json:"reserved" yaml:"reserved"`
+	Rarities      Rarities      `json:"rarities" yaml:"rarities"`
+	Colors        []StatsEntry  `json:"colors" yaml:"colors"`
+	Artists       []StatsEntry  `json:"artists" yaml:"artists"`
+	ManaCurve     []StatsEntry  `json:"mana_curve" yaml:"mana_curve"`
+	AddedPerMonth []StatsEntry  `json:"added_per_month" yaml:"added_per_month"`
+	Formats       []FormatStats `json:"formats" yaml:"formats"`
+	History       []PriceEntry  `json:"-" yaml:"-"`
+	ValueHistory  []PricePoint  `json:"history" yaml:"history"`
+}
+
+// Header and Rows flatten all statistics into section, name and value
+func (s CollectionStats) Header() []string {
+	return []string{"section", "name", "value"}
+}
+
+func (s CollectionStats) Rows() [][]string {
+	rows := [][]string{
+		{"cards", "total", fmt.Sprintf("%.0f", s.CountAll)},
+		{"cards", "unique", fmt.Sprintf("%.0f", s.Unique)},
+		{"cards", "normal", fmt.Sprintf("%.0f", s.Count)},
+		{"cards", "foil", fmt.Sprintf("%.0f", s.CountFoil)},
+		{"cards", "etched", fmt.Sprintf("%.0f", s.CountEtched)},
+		{"cards", "reserved", fmt.Sprintf("%.0f", s.Reserved)},
+		{"cards", "unpriced", fmt.Sprintf("%.0f", s.Unpriced)},
+		{"value", "total", formatFloat(s.TotalValue())},
+		{"value", "normal", formatFloat(s.Value)},
+		{"value", "foil", formatFloat(s.ValueFoil)},
+		{"value", "etched", formatFloat(s.ValueEtched)},
+		{"value", "average", formatFloat(s.AverageValue())},
+		{"rarity", "mythic", fmt.Sprintf("%.0f", s.Rarities.Mythics)},
+		{"rarity", "rare", fmt.Sprintf("%.0f", s.Rarities.Rares)},
+		{"rarity", "uncommon", fmt.Sprintf("%.0f", s.Rarities.Uncommons)},
+		{"rarity", "common", fmt.Sprintf("%.0f", s.Rarities.Commons)},
+	}
+	sections := []struct {
+		name    string
+		entries []StatsEntry
+	}{{"color", s.Colors}, {"artist", s.Artists}, {"mana_curve", s.ManaCurve}, {"added_per_month", s.AddedPerMonth}}
+	for _, section := range sections {
+		for _, e := range section.entries {
+			rows = append(rows, []string{section.name, e.Name, fmt.Sprintf("%.0f", e.Count)})
+		}
+	}
+	for _, f := range s.Formats {
+		rows = append(rows, []string{"legal_count", f.Format, fmt.Sprintf("%.0f", f.Count)})
+		rows = append(rows, []string{"legal_value", f.Format, formatFloat(f.Value)})
+	}
+	for _, p := range s.ValueHistory {
+		rows = append(rows, []string{"history", p.Date, formatFloat(p.Value + p.ValueFoil)})
+	}
+	return rows
+}
+
+// Returns the value of all finishes of cards in the collection
+func (s CollectionStats) TotalValue() float64 {
+	return s.Value + s.ValueFoil + s.ValueEtched
+}
+
+// Returns the average value of a single card in the collection
+func (s CollectionStats) AverageValue() float64 {
+	if s.CountAll == 0 {
+		return 0
+	}
+	return s.TotalValue() / s.CountAll
+}
+
+// Returns the percentage of cards without price
+func (s CollectionStats) UnpricedShare() float64 {
+	if s.CountAll == 0 {
+		return 0
+	}
+	return s.Unpriced / s.CountAll * 100
+}
+
+func showStats(v valuation, stats *CollectionStats) {
 
 	// Show Value Stats
-	showValueStats(coll, totalcoll)
+	showValueStats(v, stats)
 
 	// Reserved List
-	showReservedListStats(coll)
+	showReservedListStats(stats)
 
 	// Rarities
-	showRarityStats(coll)
+	showRarityStats(stats)
 
 	// Colors
-	showColorStats(coll)
+	showColorStats(stats)
 
 	// Artists
-	showArtistStats(coll)
+	showArtistStats(stats)
 
 	// Mana Curve of Collection
-	showManaCurveStats(coll)
+	showManaCurveStats(stats)
 
 	// Show cards added per month
-	showCardsAddedPerMonth(coll)
+	showCardsAddedPerMonth(stats)
+
+	// Legal cards per format
+	showFormatStats(v, stats)
+}
+
+// stats calculates all statistics of the collection
+func (client *Client) stats() (*CollectionStats, error) {
+	stats := &CollectionStats{
+		Currency:      client.currency,
+		Colors:        []StatsEntry{},
+		Artists:       []StatsEntry{},
+		ManaCurve:     []StatsEntry{},
+		AddedPerMonth: []StatsEntry{},
+		Formats:       []FormatStats{},
+		ValueHistory:  []PricePoint{},
+	}
+	collectors := []func(*CollectionStats) error{
+		client.collectValueStats,
+		client.collectReservedListStats,
+		client.collectRarityStats,
+		client.collectColorStats,
+		client.collectArtistStats,
+		client.collectManaCurveStats,
+		client.collectCardsAddedPerMonth,
+		client.collectFormatStats,
+	}
+	for _, collect := range collectors {
+		if err := collect(stats); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
 }
 
-func showValueStats(coll *Collection, totalcoll *Collection) {
+func (client *Client) collectValueStats(s *CollectionStats) error {
 	l := Logger()
 	// Value and Card Numbers
-	stats, _ := coll.storageAggregate(mongo.Pipeline{
+	stats, err := client.cards().storageAggregate(mongo.Pipeline{
 		bson.D{
 			{"$group", bson.D{
 				{"_id", nil},
-				{"value", bson.D{{"$sum", bson.D{{"$multiply", bson.A{getCurrencyField(false), "$serra_count"}}}}}},
-				{"value_foil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{getCurrencyField(true), "$serra_count_foil"}}}}}},
+				{"value", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.priceField(false), "$serra_count"}}}}}},
+				{"value_foil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.priceField(true), "$serra_count_foil"}}}}}},
+				{"value_etched", bson.D{{"$sum", bson.D{{"$multiply", bson.A{client.finishPriceField(FinishEtched), etchedCount}}}}}},
 				{"count", bson.D{{"$sum", bson.D{{"$multiply", bson.A{1.0, "$serra_count"}}}}}},
 				{"count_foil", bson.D{{"$sum", "$serra_count_foil"}}},
+				{"count_etched", bson.D{{"$sum", etchedCount}}},
 				{"rarity", bson.D{{"$sum", "$rarity"}}},
 				{"unique", bson.D{{"$sum", 1}}},
+				{"unpriced", bson.D{{"$sum", bson.D{{"$add", bson.A{
+					unpricedExpr(client.priceField(false), "$serra_count"),
+					unpricedExpr(client.priceField(true), "$serra_count_foil"),
+					unpricedExpr(client.finishPriceField(FinishEtched), etchedCount),
+				}}}}}},
 			}},
 		},
 		bson.D{
 			{"$addFields", bson.D{
-				{"count_all", bson.D{{"$sum", bson.A{"$count", "$count_foil"}}}},
+				{"count_all", bson.D{{"$sum", bson.A{"$count", "$count_foil", "$count_etched"}}}},
 			}},
 		},
 	})
-	fmt.Printf("%sCards %s\n", Green, Reset)
-	fmt.Printf("Total: %s%.0f%s\n", Yellow, stats[0]["count_all"], Reset)
-	fmt.Printf("Unique: %s%d%s\n", Purple, stats[0]["unique"], Reset)
-	fmt.Printf("Normal: %s%.0f%s\n", Purple, stats[0]["count"], Reset)
-	fmt.Printf("Foil: %s%d%s\n", Purple, stats[0]["count_foil"], Reset)
-
-	// Total Value
-	fmt.Printf("\n%sTotal Value%s\n", Green, Reset)
-	normalValue, err := getFloat64(stats[0]["value"])
 	if err != nil {
+		return err
+	}
+
+	// empty collection
+	if len(stats) == 0 {
+		return nil
+	}
+
+	if s.Value, err = getFloat64(stats[0]["value"]); err != nil {
 		l.Error(err)
-		normalValue = 0
 	}
-	foilValue, err := getFloat64(stats[0]["value_foil"])
-	if err != nil {
+	if s.ValueFoil, err = getFloat64(stats[0]["value_foil"]); err != nil {
 		l.Error(err)
-		foilValue = 0
 	}
-	count_all, err := getFloat64(stats[0]["count_all"])
-	if err != nil {
+	if s.ValueEtched, err = getFloat64(stats[0]["value_etched"]); err != nil {
+		l.Error(err)
+	}
+	if s.CountAll, err = getFloat64(stats[0]["count_all"]); err != nil {
 		l.Error(err)
-		foilValue = 0
 	}
-	totalValue := normalValue + foilValue
-	fmt.Printf("Total: %s%.2f%s%s\n", Pink, totalValue, getCurrency(), Reset)
-	fmt.Printf("Normal: %s%.2f%s%s\n", Pink, normalValue, getCurrency(), Reset)
-	fmt.Printf("Foils: %s%.2f%s%s\n", Pink, foilValue, getCurrency(), Reset)
-	fmt.Printf("Average Card: %s%.2f%s%s\n", Pink, totalValue/count_all, getCurrency(), Reset)
-	total, _ := totalcoll.storageFindTotal()
+	s.Count, _ = getFloat64(stats[0]["count"])
+	s.CountFoil, _ = getFloat64(stats[0]["count_foil"])
+	s.CountEtched, _ = getFloat64(stats[0]["count_etched"])
+	s.Unique, _ = getFloat64(stats[0]["unique"])
+	s.Unpriced, _ = getFloat64(stats[0]["unpriced"])
 
-	fmt.Printf("History: \n")
-	showPriceHistory(total.Value, "* ", true)
+	total, err := client.totals().storageFindTotal()
+	if err != nil {
+		return err
+	}
+	s.History = total.Value
+	s.ValueHistory = newPriceHistory(client.valuation(), total.Value)
+	return nil
 }
 
-func showReservedListStats(coll *Collection) {
-	reserved, _ := coll.storageAggregate(mongo.Pipeline{
+func (client *Client) collectReservedListStats(s *CollectionStats) error {
+	reserved, err := client.cards().storageAggregate(mongo.Pipeline{
 		bson.D{
 			{"$match", bson.D{
 				{"reserved", true}}}},
@@ -119,16 +268,18 @@ func showReservedListStats(coll *Collection) {
 				{"count", bson.D{{"$sum", 1}}},
 			}}},
 	})
+	if err != nil {
+		return err
+	}
 
-	var count_reserved int32
 	if len(reserved) > 0 {
-		count_reserved = reserved[0]["count"].(int32)
+		s.Reserved, _ = getFloat64(reserved[0]["count"])
 	}
-	fmt.Printf("Reserved List: %s%d%s\n", Yellow, count_reserved, Reset)
+	return nil
 }
 
-func showRarityStats(coll *Collection) {
-	rar, _ := coll.storageAggregate(mongo.Pipeline{
+func (client *Client) collectRarityStats(s *CollectionStats) error {
+	rar, err := client.cards().storageAggregate(mongo.Pipeline{
 		bson.D{
 			{"$group", bson.D{
 				{"_id", "$rarity"},
@@ -139,16 +290,14 @@ func showRarityStats(coll *Collection) {
 				{"_id", 1},
 			}}},
 	})
-	ri := convertRarities(rar)
-	fmt.Printf("\n%sRarity%s\n", Green, Reset)
-	fmt.Printf("Mythics: %s%.0f%s\n", Pink, ri.Mythics, Reset)
-	fmt.Printf("Rares: %s%.0f%s\n", Pink, ri.Rares, Reset)
-	fmt.Printf("Uncommons: %s%.0f%s\n", Yellow, ri.Uncommons, Reset)
-	fmt.Printf("Commons: %s%.0f%s\n", Purple, ri.Commons, Reset)
+	if err != nil {
+		return err
+	}
+	s.Rarities = convertRarities(rar)
+	return nil
 }
 
-func showCardsAddedPerMonth(coll *Collection) {
-	fmt.Printf("\n%sCards added over time%s\n", Green, Reset)
+func (client *Client) collectCardsAddedPerMonth(s *CollectionStats) error {
 	type Caot struct {
 		Id struct {
 			Year  int32 `mapstructure:"year"`
@@ -156,7 +305,7 @@ func showCardsAddedPerMonth(coll *Collection) {
 		} `mapstructure:"_id"`
 		Count int32 `mapstructure:"count"`
 	}
-	caot, _ := coll.storageAggregate(mongo.Pipeline{
+	caot, err := client.cards().storageAggregate(mongo.Pipeline{
 		bson.D{
 			{"$project", bson.D{
 				{"month", bson.D{
@@ -175,15 +324,19 @@ func showCardsAddedPerMonth(coll *Collection) {
 			{"$sort", bson.D{{"_id.year", 1}, {"_id.month", 1}}},
 		},
 	})
+	if err != nil {
+		return err
+	}
 	for _, mo := range caot {
 		moo := new(Caot)
 		mapstructure.Decode(mo, moo)
-		fmt.Printf("%d-%02d: %s%d%s\n", moo.Id.Year, moo.Id.Month, Purple, moo.Count, Reset)
+		s.AddedPerMonth = append(s.AddedPerMonth, StatsEntry{fmt.Sprintf("%d-%02d", moo.Id.Year, moo.Id.Month), float64(moo.Count)})
 	}
+	return nil
 }
 
-func showManaCurveStats(coll *Collection) {
-	cmc, _ := coll.storageAggregate(mongo.Pipeline{
+func (client *Client) collectManaCurveStats(s *CollectionStats) error {
+	cmc, err := client.cards().storageAggregate(mongo.Pipeline{
 		bson.D{
 			{"$group", bson.D{
 				{"_id", "$cmc"},
@@ -194,14 +347,18 @@ func showManaCurveStats(coll *Collection) {
 				{"_id", 1},
 			}}},
 	})
-	fmt.Printf("\n%sMana Curve%s\n", Green, Reset)
+	if err != nil {
+		return err
+	}
 	for _, mc := range cmc {
-		fmt.Printf("%.0f: %s%d%s\n", mc["_id"], Purple, mc["count"], Reset)
+		count, _ := getFloat64(mc["count"])
+		s.ManaCurve = append(s.ManaCurve, StatsEntry{fmt.Sprintf("%.0f", mc["_id"]), count})
 	}
+	return nil
 }
 
-func showArtistStats(coll *Collection) {
-	artists, _ := coll.storageAggregate(mongo.Pipeline{
+func (client *Client) collectArtistStats(s *CollectionStats) error {
+	artists, err := client.cards().storageAggregate(mongo.Pipeline{
 		bson.D{
 			{"$group", bson.D{
 				{"_id", "$artist"},
@@ -214,14 +371,18 @@ func showArtistStats(coll *Collection) {
 		bson.D{
 			{"$limit", 10}},
 	})
-	fmt.Printf("\n%sTop Artists%s\n", Green, Reset)
+	if err != nil {
+		return err
+	}
 	for _, artist := range artists {
-		fmt.Printf("%s: %s%d%s\n", artist["_id"].(string), Purple, artist["count"], Reset)
+		count, _ := getFloat64(artist["count"])
+		s.Artists = append(s.Artists, StatsEntry{artist["_id"].(string), count})
 	}
+	return nil
 }
 
-func showColorStats(coll *Collection) {
-	sets, _ := coll.storageAggregate(mongo.Pipeline{
+func (client *Client) collectColorStats(s *CollectionStats) error {
+	sets, err := client.cards().storageAggregate(mongo.Pipeline{
 		bson.D{
 			{"$match", bson.D{
 				{"coloridentity", bson.D{{"$size", 1}}}}}},
@@ -235,11 +396,112 @@ func showColorStats(coll *Collection) {
 				{"count", -1},
 			}}},
 	})
-
-	fmt.Printf("\n%sColors%s\n", Green, Reset)
+	if err != nil {
+		return err
+	}
 	for _, set := range sets {
 		x, _ := set["_id"].(primitive.A)
-		s := []interface{}(x)
-		fmt.Printf("%s: %s%.0f%s\n", convertManaSymbols(s), Purple, set["count"], Reset)
+		count, _ := getFloat64(set["count"])
+		s.Colors = append(s.Colors, StatsEntry{convertManaSymbols([]interface{}(x)), count})
+	}
+	return nil
+}
+
+func (client *Client) collectFormatStats(s *CollectionStats) error {
+	group := bson.D{{"_id", nil}}
+	formats := (Card{}).LegalityList()
+	for _, f := range formats {
+		legal := bson.D{{"$eq", bson.A{"$legalities." + f.Format, "legal"}}}
+		group = append(group,
+			bson.E{f.Format + "_count", bson.D{{"$sum", bson.D{{"$cond", bson.A{legal, bson.D{{"$add", bson.A{"$serra_count", "$serra_count_foil", etchedCount}}}, 0}}}}}},
+			bson.E{f.Format + "_value", bson.D{{"$sum", bson.D{{"$cond", bson.A{legal, bson.D{{"$add", bson.A{
+				valueExpr(client.priceField(false), "$serra_count"),
+				valueExpr(client.priceField(true), "$serra_count_foil"),
+				valueExpr(client.finishPriceField(FinishEtched), etchedCount),
+			}}}, 0}}}}}},
+		)
+	}
+
+	result, err := client.cards().storageAggregate(mongo.Pipeline{bson.D{{"$group", group}}})
+	if err != nil {
+		return err
+	}
+	if len(result) == 0 {
+		return nil
+	}
+
+	for _, f := range formats {
+		count, _ := getFloat64(result[0][f.Format+"_count"])
+		value, _ := getFloat64(result[0][f.Format+"_value"])
+		s.Formats = append(s.Formats, FormatStats{f.Format, count, value})
+	}
+	return nil
+}
+
+func showValueStats(v valuation, s *CollectionStats) {
+	fmt.Printf("%sCards %s\n", Green, Reset)
+	fmt.Printf("Total: %s%.0f%s\n", Yellow, s.CountAll, Reset)
+	fmt.Printf("Unique: %s%.0f%s\n", Purple, s.Unique, Reset)
+	fmt.Printf("Normal: %s%.0f%s\n", Purple, s.Count, Reset)
+	fmt.Printf("Foil: %s%.0f%s\n", Purple, s.CountFoil, Reset)
+	fmt.Printf("Etched: %s%.0f%s\n", Purple, s.CountEtched, Reset)
+
+	// Total Value
+	fmt.Printf("\n%sTotal Value%s\n", Green, Reset)
+	fmt.Printf("Total: %s%.2f%s%s\n", Pink, s.TotalValue(), v.symbol(), Reset)
+	fmt.Printf("Normal: %s%.2f%s%s\n", Pink, s.Value, v.symbol(), Reset)
+	fmt.Printf("Foils: %s%.2f%s%s\n", Pink, s.ValueFoil, v.symbol(), Reset)
+	fmt.Printf("Etched: %s%.2f%s%s\n", Pink, s.ValueEtched, v.symbol(), Reset)
+	fmt.Printf("Average Card: %s%.2f%s%s\n", Pink, s.AverageValue(), v.symbol(), Reset)
+	fmt.Printf("Unpriced: %s%.0f%s (%.1f%%)\n", Pink, s.Unpriced, Reset, s.UnpricedShare())
+
+	fmt.Printf("History: \n")
+	showPriceHistory(v, s.History, "* ", true)
+}
+
+func showReservedListStats(s *CollectionStats) {
+	fmt.Printf("Reserved List: %s%.0f%s\n", Yellow, s.Reserved, Reset)
+}
+
+func showRarityStats(s *CollectionStats) {
+	fmt.Printf("\n%sRarity%s\n", Green, Reset)
+	fmt.Printf("Mythics: %s%.0f%s\n", Pink, s.Rarities.Mythics, Reset)
+	fmt.Printf("Rares: %s%.0f%s\n", Pink, s.Rarities.Rares, Reset)
+	fmt.Printf("Uncommons: %s%.0f%s\n", Yellow, s.Rarities.Uncommons, Reset)
+	fmt.Printf("Commons: %s%.0f%s\n", Purple, s.Rarities.Commons, Reset)
+}
+
+func showCardsAddedPerMonth(s *CollectionStats) {
+	fmt.Printf("\n%sCards added over time%s\n", Green, Reset)
+	for _, e := range s.AddedPerMonth {
+		fmt.Printf("%s: %s%.0f%s\n", e.Name, Purple, e.Count, Reset)
+	}
+}
+
+func showManaCurveStats(s *CollectionStats) {
+	fmt.Printf("\n%sMana Curve%s\n", Green, Reset)
+	for _, e := range s.ManaCurve {
+		fmt.Printf("%s: %s%.0f%s\n", e.Name, Purple, e.Count, Reset)
+	}
+}
+
+func showArtistStats(s *CollectionStats) {
+	fmt.Printf("\n%sTop Artists%s\n", Green, Reset)
+	for _, e := range s.Artists {
+		fmt.Printf("%s: %s%.0f%s\n", e.Name, Purple, e.Count, Reset)
+	}
+}
+
+func showColorStats(s *CollectionStats) {
+	fmt.Printf("\n%sColors%s\n", Green, Reset)
+	for _, e := range s.Colors {
+		fmt.Printf("%s: %s%.0f%s\n", e.Name, Purple, e.Count, Reset)
+	}
+}
+
+func showFormatStats(v valuation, s *CollectionStats) {
+	fmt.Printf("\n%sLegal in Format%s\n", Green, Reset)
+	for _, f := range s.Formats {
+		fmt.Printf("%s: %s%.0f%s cards, %s%.2f%s%s\n", f.Format, Purple, f.Count, Reset, Pink, f.Value, v.symbol(), Reset)
 	}
 }
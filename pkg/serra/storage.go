@@ -2,8 +2,8 @@ package serra
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,61 +17,85 @@ type Total struct {
 	Value []PriceEntry `bson:"value"`
 }
 
+// StorageError is returned, if a storage operation failed. Unlike invalid
+// input, it is usually worth retrying later.
+type StorageError struct {
+	Op  string
+	Err error
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("Could not %s: %s", e.Op, e.Err)
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
 // https://siongui.github.io/2017/02/11/go-add-method-function-to-type-in-external-package/
 type Collection struct {
 	*mongo.Collection
+
+	// session context of a running transaction, if any
+	tx context.Context
 }
 
-// Returns configured human readable name for
-// the configured currency of the user
-func getCurrencyField(foil bool) string {
-	switch os.Getenv("SERRA_CURRENCY") {
-	case "EUR":
-		if foil {
-			return "$prices.eur_foil"
-		}
-		return "$prices.eur"
-	case "USD":
-		if foil {
-			return "$prices.usd_foil"
-		}
-		return "$prices.usd"
-	default:
-		if foil {
-			return "$prices.usd_foil"
-		}
-		return "$prices.usd"
-	}
-}
-
-func storageConnect() *mongo.Client {
-	l := Logger()
-	uri := getMongoDBURI()
-
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
-	if err != nil {
-		l.Fatalf("Could not connect to mongodb at %s", uri)
+// ctx returns the context for storage calls
+func (coll Collection) ctx() context.Context {
+	if coll.tx != nil {
+		return coll.tx
 	}
-
-	return client
-
+	return context.TODO()
 }
 
 func (coll Collection) storageAdd(card *Card) error {
 
 	card.SerraUpdated = primitive.NewDateTimeFromTime(time.Now())
 
-	_, err := coll.InsertOne(context.TODO(), card)
+	_, err := coll.InsertOne(coll.ctx(), card)
 	if err != nil {
-		return err
+		return &StorageError{"add card", err}
 	}
 	return nil
 
 }
 
+// storageUpsertCard adds an amount of a card to the count field in a single
+// update. The card is inserted, if it is not in the collection yet. Unique
+// adds only insert the card and leave existing cards alone. Returns true if
+// the card was inserted.
+func (coll Collection) storageUpsertCard(card *Card, field string, amount int64, unique bool) (bool, error) {
+
+	card.SerraUpdated = primitive.NewDateTimeFromTime(time.Now())
+
+	raw, err := bson.Marshal(card)
+	if err != nil {
+		return false, &StorageError{"add card", err}
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return false, &StorageError{"add card", err}
+	}
+
+	update := bson.D{{"$setOnInsert", doc}}
+	if unique {
+		doc[field] = amount
+	} else {
+		delete(doc, field)
+		update = append(update, bson.E{"$inc", bson.D{{field, amount}}})
+	}
+
+	filter := bson.D{{"set", card.Set}, {"collectornumber", card.CollectorNumber}}
+	res, err := coll.UpdateOne(coll.ctx(), filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return false, &StorageError{"add card", err}
+	}
+	return res.UpsertedCount > 0, nil
+}
+
 func (coll Collection) storageAddSet(set *Set) (*mongo.InsertOneResult, error) {
 
-	id, err := coll.InsertOne(context.TODO(), set)
+	id, err := coll.InsertOne(coll.ctx(), set)
 	if err != nil {
 		return id, err
 	}
@@ -82,55 +106,49 @@ func (coll Collection) storageAddSet(set *Set) (*mongo.InsertOneResult, error) {
 func (coll Collection) storageAddTotal(p PriceEntry) error {
 
 	// create total object if not exists...
-	coll.InsertOne(context.TODO(), Total{ID: "1", Value: []PriceEntry{}})
+	coll.InsertOne(coll.ctx(), Total{ID: "1", Value: []PriceEntry{}})
 
 	// update object as intended...
 	filter := bson.D{{"_id", "1"}}
 	update := bson.M{"$push": bson.M{"value": p}}
 
 	_, err := coll.UpdateOne(
-		context.Background(),
+		coll.ctx(),
 		filter,
 		update,
 	)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return &StorageError{"update total data", err}
 	}
 	return nil
 }
 
 func (coll Collection) storageFind(filter, sort bson.D, skip, limit int64) ([]Card, error) {
 	opts := options.Find().SetSort(sort).SetSkip(skip).SetLimit(limit)
-	cursor, err := coll.Find(context.TODO(), filter, opts)
-	l := Logger()
-
+	cursor, err := coll.Find(coll.ctx(), filter, opts)
 	if err != nil {
-		l.Fatalf("Could not query data due to connection errors to database: %s", err.Error())
+		return []Card{}, &StorageError{"query card data", err}
 	}
 
 	var results []Card
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		l.Fatal(err)
-		return []Card{}, err
+	if err = cursor.All(coll.ctx(), &results); err != nil {
+		return []Card{}, &StorageError{"read card data", err}
 	}
 	return results, nil
 
 }
 
 func (coll Collection) storageFindSet(filter, sort bson.D) ([]Set, error) {
-	l := Logger()
 	opts := options.Find().SetSort(sort)
 
-	cursor, err := coll.Find(context.TODO(), filter, opts)
+	cursor, err := coll.Find(coll.ctx(), filter, opts)
 	if err != nil {
-		l.Fatalf("Could not query set data due to connection errors to database: %s", err.Error())
+		return []Set{}, &StorageError{"query set data", err}
 	}
 
 	var results []Set
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		l.Fatal(err)
-		return []Set{}, err
+	if err = cursor.All(coll.ctx(), &results); err != nil {
+		return []Set{}, &StorageError{"read set data", err}
 	}
 
 	return results, nil
@@ -138,67 +156,113 @@ func (coll Collection) storageFindSet(filter, sort bson.D) ([]Set, error) {
 
 func (coll Collection) storageFindTotal() (Total, error) {
 	var total Total
-	l := Logger()
 
-	err := coll.FindOne(context.TODO(), bson.D{{"_id", "1"}}).Decode(&total)
+	err := coll.FindOne(coll.ctx(), bson.D{{"_id", "1"}}).Decode(&total)
+
+	// there is no total before the first update
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Total{ID: "1", Value: []PriceEntry{}}, nil
+	}
 	if err != nil {
-		l.Fatalf("Could not query total data due to connection errors to database: %s", err.Error())
+		return total, &StorageError{"query total data", err}
 	}
 
 	return total, nil
 }
 
-func (coll Collection) storageRemove(filter bson.M) error {
-	l := Logger()
+// storageAddRates stores the rates of several days, replacing rates of days
+// that are already stored
+func (coll Collection) storageAddRates(table RateTable) error {
+	models := []mongo.WriteModel{}
+	for _, r := range table {
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.D{{"date", r.Date}}).SetReplacement(r).SetUpsert(true))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	if _, err := coll.BulkWrite(coll.ctx(), models); err != nil {
+		return &StorageError{"add rates", err}
+	}
+	return nil
+}
 
-	_, err := coll.DeleteOne(context.TODO(), filter)
+func (coll Collection) storageFindRates() (RateTable, error) {
+	cursor, err := coll.Find(coll.ctx(), bson.D{}, options.Find().SetSort(bson.D{{"date", 1}}))
 	if err != nil {
-		l.Fatalf("Could remove card data due to connection errors to database: %s", err.Error())
+		return nil, &StorageError{"query rates", err}
+	}
+
+	table := RateTable{}
+	if err = cursor.All(coll.ctx(), &table); err != nil {
+		return nil, &StorageError{"read rates", err}
+	}
+	return table, nil
+}
+
+func (coll Collection) storageRemove(filter bson.M) error {
+	_, err := coll.DeleteOne(coll.ctx(), filter)
+	if err != nil {
+		return &StorageError{"remove card data", err}
 	}
 
 	return nil
 }
 
 func (coll Collection) storageAggregate(pipeline mongo.Pipeline) ([]primitive.M, error) {
-	l := Logger()
 	opts := options.Aggregate()
 
 	cursor, err := coll.Aggregate(
-		context.TODO(),
+		coll.ctx(),
 		pipeline,
 		opts)
 	if err != nil {
-		l.Fatalf("Could not aggregate data due to connection errors to database: %s", err.Error())
+		return []primitive.M{}, &StorageError{"aggregate data", err}
 	}
 
 	// Get a list of all returned documents and print them out.
 	// See the mongo.Cursor documentation for more examples of using cursors.
 	var results []bson.M
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		l.Fatal(err)
+	if err = cursor.All(coll.ctx(), &results); err != nil {
+		return []primitive.M{}, &StorageError{"read aggregated data", err}
 	}
 
 	return results, nil
 }
 
 func (coll Collection) storageUpdate(filter, update bson.M) error {
-	l := Logger()
 	// Call the driver's UpdateOne() method and pass filter and update to it
 	_, err := coll.UpdateOne(
-		context.Background(),
+		coll.ctx(),
 		filter,
 		update,
 	)
 	if err != nil {
-		l.Fatalf("Could not update data due to connection errors to database: %s", err.Error())
+		return &StorageError{"update data", err}
 	}
 
 	return nil
 }
 
-func storageDisconnect(client *mongo.Client) error {
-	if err := client.Disconnect(context.TODO()); err != nil {
+// storageTransaction runs fn within a multi-document transaction. All storage
+// calls within fn need to use the given session context.
+func storageTransaction(client *mongo.Client, fn func(ctx mongo.SessionContext) error) error {
+	session, err := client.StartSession()
+	if err != nil {
 		return err
 	}
-	return nil
+	defer session.EndSession(context.TODO())
+
+	_, err = session.WithTransaction(context.TODO(), func(ctx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(ctx)
+	})
+
+	// standalone servers do not support transactions, the first storage call
+	// fails with IllegalOperation before anything is written
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 20 {
+		Logger().Warn("Storage does not support transactions (no replica set), changes are applied one by one")
+		return fn(mongo.NewSessionContext(context.TODO(), session))
+	}
+	return err
 }
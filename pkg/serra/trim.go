@@ -0,0 +1,248 @@
+package serra
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	trimCmd.Flags().StringVarP(&set, "set", "s", "", "Filter by set code (usg/mmq/vow)")
+	trimCmd.Flags().Int64VarP(&trimMinCount, "min-count", "c", 2, "Only list cards you own at least X times")
+	rootCmd.AddCommand(trimCmd)
+}
+
+var trimCmd = &cobra.Command{
+	Use:   "trim",
+	Short: "Trim duplicates of your collection in an editor",
+	Long: `Lists the cards you own several times in $EDITOR. Lower the amounts
+of the cards you do not want to keep anymore or delete their lines to remove
+them completely. After confirmation, all changes are applied at once.`,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		return client.trimCards(set, trimMinCount)
+	},
+}
+
+// TrimEntry is the amount of a card in a finish, as listed in the editor
+type TrimEntry struct {
+	Card   Card
+	Finish string
+	Count  int64
+}
+
+// Key identifying the entry in the edited list, like "usg/13 f"
+func (e TrimEntry) Key() string {
+	return trimKey(e.Card.Set, e.Card.CollectorNumber, e.Finish)
+}
+
+func trimKey(set, number, finish string) string {
+	switch finish {
+	case FinishFoil:
+		return fmt.Sprintf("%s/%s f", set, number)
+	case FinishEtched:
+		return fmt.Sprintf("%s/%s e", set, number)
+	}
+	return fmt.Sprintf("%s/%s", set, number)
+}
+
+func (client *Client) trimCards(set string, minCount int64) error {
+	if len(set) == 0 {
+		return fmt.Errorf("Option --set <set> must be given")
+	}
+
+	cards, err := client.findCards(CardFilter{Set: set, MinCount: minCount, Cmc: -1}, "number", 0, 0)
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		return fmt.Errorf("No cards in %s owned at least %d times", set, minCount)
+	}
+
+	entries := []TrimEntry{}
+	for _, c := range cards {
+		for _, finish := range []string{FinishNormal, FinishFoil, FinishEtched} {
+			if n := c.getCount(finish); n > 0 {
+				entries = append(entries, TrimEntry{Card: c, Finish: finish, Count: n})
+			}
+		}
+	}
+
+	edited, err := editTrimList(client.valuation(), entries)
+	if err != nil {
+		return err
+	}
+
+	changes, err := diffTrimList(entries, edited)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("Nothing changed")
+		return nil
+	}
+
+	showTrimChanges(client.valuation(), changes)
+	answer, err := askStdin(fmt.Sprintf("Apply %d changes? [y/N] ", len(changes)))
+	if err != nil || strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		fmt.Println("Nothing changed")
+		return nil
+	}
+
+	if err := client.applyCardChanges(changes); err != nil {
+		return err
+	}
+	fmt.Printf("%sApplied %d changes%s\n", Green, len(changes), Reset)
+	return nil
+}
+
+// editTrimList writes the entries to a temporary file, opens it in $EDITOR
+// and returns the amounts of the edited file
+func editTrimList(v valuation, entries []TrimEntry) (map[string]int64, error) {
+	f, err := os.CreateTemp("", "serra-trim-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	fmt.Fprintln(f, "# Lower the amounts of cards or delete lines to remove all copies.")
+	fmt.Fprintln(f, "# Everything after # is ignored.")
+	for _, e := range entries {
+		fmt.Fprintf(f, "%-14s %3d  # %s (%.2f%s)\n", e.Key(), e.Count, e.Card.Name, v.cardFinishValue(e.Card, e.Finish), v.symbol())
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Editor %s failed: %w", editor[0], err)
+	}
+
+	edited, err := os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer edited.Close()
+
+	return readTrimList(edited)
+}
+
+// readTrimList parses lines like "usg/13 f 2" into amounts per entry key
+func readTrimList(r io.Reader) (map[string]int64, error) {
+	amounts := map[string]int64{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		input, _, _ := strings.Cut(scanner.Text(), "#")
+		words := strings.Fields(input)
+		if len(words) == 0 {
+			continue
+		}
+		if !isCardID(words[0]) {
+			return nil, fmt.Errorf("Line %d: invalid card %q, use set/number", line, words[0])
+		}
+
+		// an amount of 0 is fine here, unlike in the prompt
+		var amount int64 = -1
+		rest := []string{}
+		for _, w := range words[1:] {
+			if w == "0" {
+				amount = 0
+				continue
+			}
+			rest = append(rest, w)
+		}
+
+		parts := strings.SplitN(words[0], "/", 2)
+		entry, err := parsePromptLine(strings.Join(append([]string{parts[1]}, rest...), " "))
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %w", line, err)
+		}
+		if len(entry.Numbers) != 1 {
+			return nil, fmt.Errorf("Line %d: ranges are not supported", line)
+		}
+		if amount < 0 {
+			amount = entry.Count
+		}
+
+		key := trimKey(strings.ToLower(parts[0]), entry.Numbers[0], entry.Finish)
+		if _, ok := amounts[key]; ok {
+			return nil, fmt.Errorf("Line %d: %s is listed twice", line, key)
+		}
+		amounts[key] = amount
+	}
+
+	return amounts, scanner.Err()
+}
+
+// diffTrimList compares the listed entries with the edited amounts. Cards
+// missing in the edited list are removed completely.
+func diffTrimList(entries []TrimEntry, edited map[string]int64) ([]CardChange, error) {
+	listed := map[string]bool{}
+	changes := []CardChange{}
+	for _, e := range entries {
+		listed[e.Key()] = true
+
+		amount, ok := edited[e.Key()]
+		if !ok {
+			amount = 0
+		}
+		if amount > e.Count {
+			return nil, fmt.Errorf("%s: amount can only be lowered, use serra add to add cards", e.Key())
+		}
+		if amount != e.Count {
+			changes = append(changes, CardChange{Card: e.Card, Finish: e.Finish, Amount: amount - e.Count})
+		}
+	}
+
+	for key := range edited {
+		if !listed[key] {
+			return nil, fmt.Errorf("%s was not part of the list", key)
+		}
+	}
+	return changes, nil
+}
+
+// showTrimChanges prints all changes and their value impact
+func showTrimChanges(v valuation, changes []CardChange) {
+	var value float64
+	for _, c := range changes {
+		before := c.Card.getCount(c.Finish)
+		fmt.Printf("* %s%s%s %s: %d -> %d (%s%.2f%s%s)\n", Purple, trimKey(c.Card.Set, c.Card.CollectorNumber, c.Finish), Reset, c.Card.Name, before, before+c.Amount, Yellow, v.changeValue(c), v.symbol(), Reset)
+		value += v.changeValue(c)
+	}
+	fmt.Printf("\nValue of the collection changes by %s%.2f%s%s\n", Yellow, value, v.symbol(), Reset)
+}
+
+// applyCardChanges applies changes of several cards within one transaction.
+// Cards without any copy left are removed.
+func (client *Client) applyCardChanges(changes []CardChange) error {
+	return client.transaction(func(tx *Client) error {
+		for _, c := range changes {
+			if _, err := modifyCardCount(tx.cards(), tx.valuation(), &c.Card, c.Amount, c.Finish); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package serra
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadTrimList(t *testing.T) {
+	list := `# Lower the amounts of cards or delete lines to remove all copies.
+usg/13           3  # Lightning Bolt (1.20$)
+USG/014 f        0  # Counterspell (0.50$)
+
+usg/15 e`
+
+	got, err := readTrimList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"usg/13": 3, "usg/14 f": 0, "usg/15 e": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readTrimList() = %v, want %v", got, want)
+	}
+
+	for _, list := range []string{"Lightning Bolt 2", "usg/1-3 1", "usg/13 2\nusg/013 1"} {
+		if got, err := readTrimList(strings.NewReader(list)); err == nil {
+			t.Errorf("readTrimList(%q) = %v, want error", list, got)
+		}
+	}
+}
+
+func TestDiffTrimList(t *testing.T) {
+	bolt := Card{Name: "Lightning Bolt", Set: "usg", CollectorNumber: "13"}
+	counter := Card{Name: "Counterspell", Set: "usg", CollectorNumber: "14"}
+	entries := []TrimEntry{
+		{Card: bolt, Finish: FinishNormal, Count: 4},
+		{Card: counter, Finish: FinishFoil, Count: 2},
+	}
+
+	// deleted lines remove all copies
+	got, err := diffTrimList(entries, map[string]int64{"usg/13": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CardChange{
+		{Card: bolt, Finish: FinishNormal, Amount: -3},
+		{Card: counter, Finish: FinishFoil, Amount: -2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffTrimList() = %+v, want %+v", got, want)
+	}
+
+	// amounts can only be lowered and only listed cards changed
+	for _, edited := range []map[string]int64{{"usg/13": 5}, {"usg/14": 2}} {
+		if got, err := diffTrimList(entries, edited); err == nil {
+			t.Errorf("diffTrimList(%v) = %+v, want error", edited, got)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package serra
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse and edit your collection in the terminal",
+	Long: `Full screen terminal interface to search the cards of your collection,
+browse your sets and change the amount of cards you own.
+
+Keys:
+  tab       switch between cards and sets
+  /         search cards (scryfall like query, see "serra card --help")
+  enter     show card details or cards of a set
+  + / -     add or remove a normal card
+  > / <     add or remove a foil card
+  esc       go back
+  q         quit`,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		// log messages would break the screen
+		logOutput = io.Discard
+		defer func() { logOutput = os.Stderr }()
+
+		_, err = tea.NewProgram(newTuiModel(client), tea.WithAltScreen()).Run()
+		return err
+	},
+}
+
+type tuiView int
+
+const (
+	tuiCards tuiView = iota
+	tuiSets
+	tuiDetail
+)
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("5"))
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	tuiValueStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	tuiMutedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	tuiErrorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+// Messages of background commands
+type (
+	tuiCardsMsg struct {
+		cards []Card
+		err   error
+	}
+	tuiSetsMsg struct {
+		sets SetSummaries
+		err  error
+	}
+	tuiCardMsg struct {
+		card   Card
+		status string
+		err    error
+	}
+)
+
+type tuiModel struct {
+	client    *Client
+	view      tuiView
+	search    textinput.Model
+	filter    CardFilter
+	cards     []Card
+	cursor    int
+	sets      SetSummaries
+	setCursor int
+	status    string
+	err       error
+	width     int
+	height    int
+}
+
+func newTuiModel(client *Client) tuiModel {
+	search := textinput.New()
+	search.Prompt = "/ "
+	search.Placeholder = "t:creature c>=ug cmc<=3"
+
+	return tuiModel{
+		client: client,
+		search: search,
+		filter: CardFilter{Cmc: -1},
+		width:  80,
+		height: 24,
+	}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(tuiLoadCards(m.client, m.filter), tuiLoadSets(m.client))
+}
+
+func tuiLoadCards(client *Client, f CardFilter) tea.Cmd {
+	return func() tea.Msg {
+		cards, err := client.findCards(f, "name", 0, 0)
+		return tuiCardsMsg{cards, err}
+	}
+}
+
+func tuiLoadSets(client *Client) tea.Cmd {
+	return func() tea.Msg {
+		sets, err := client.Sets("release")
+		return tuiSetsMsg{sets, err}
+	}
+}
+
+// tuiModifyCount changes the amount of a card and reloads it from the
+// collection
+func tuiModifyCount(client *Client, card Card, amount int64, finish string) tea.Cmd {
+	return func() tea.Msg {
+		coll := client.cards()
+
+		deleted, err := modifyCardCount(coll, client.valuation(), &card, amount, finish)
+		if err != nil {
+			return tuiCardMsg{card: card, err: err}
+		}
+		if deleted {
+			card.SerraCount, card.SerraCountFoil, card.SerraCountEtched = 0, 0, 0
+			return tuiCardMsg{card: card, status: fmt.Sprintf("%s (%s/%s) removed from collection", card.Name, card.Set, card.CollectorNumber)}
+		}
+
+		stored, err := coll.storageFind(bson.D{{"_id", card.ID}}, bson.D{{"_id", 1}}, 0, 0)
+		if err != nil || len(stored) == 0 {
+			return tuiCardMsg{card: card, err: err}
+		}
+
+		return tuiCardMsg{card: stored[0], status: fmt.Sprintf("%s (%s/%s): %+d %s", card.Name, card.Set, card.CollectorNumber, amount, finish)}
+	}
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case tuiCardsMsg:
+		m.cards, m.err = msg.cards, msg.err
+		m.cursor = 0
+		return m, nil
+
+	case tuiSetsMsg:
+		m.sets, m.err = msg.sets, msg.err
+		return m, nil
+
+	case tuiCardMsg:
+		m.err = msg.err
+		if msg.err == nil {
+			m.status = msg.status
+			for i := range m.cards {
+				if m.cards[i].ID == msg.card.ID {
+					m.cards[i] = msg.card
+				}
+			}
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.search.Focused() {
+			return m.updateSearch(msg)
+		}
+		return m.updateKeys(msg)
+	}
+
+	return m, nil
+}
+
+func (m tuiModel) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.search.Blur()
+		m.filter = CardFilter{Cmc: -1, Query: m.search.Value()}
+		m.status = ""
+		return m, tuiLoadCards(m.client, m.filter)
+	case "esc":
+		m.search.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	return m, cmd
+}
+
+func (m tuiModel) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "tab":
+		if m.view == tuiSets {
+			m.view = tuiCards
+		} else {
+			m.view = tuiSets
+		}
+		return m, nil
+	case "esc", "backspace":
+		if m.view == tuiDetail {
+			m.view = tuiCards
+		}
+		return m, nil
+	case "/":
+		m.view = tuiCards
+		return m, m.search.Focus()
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-m.listHeight())
+	case "pgdown":
+		m.move(m.listHeight())
+	case "enter":
+		return m.enter()
+	case "+":
+		return m, m.modify(1, FinishNormal)
+	case "-":
+		return m, m.modify(-1, FinishNormal)
+	case ">":
+		return m, m.modify(1, FinishFoil)
+	case "<":
+		return m, m.modify(-1, FinishFoil)
+	}
+	return m, nil
+}
+
+func (m *tuiModel) move(delta int) {
+	if m.view == tuiSets {
+		m.setCursor = clamp(m.setCursor+delta, 0, len(m.sets)-1)
+		return
+	}
+	m.cursor = clamp(m.cursor+delta, 0, len(m.cards)-1)
+}
+
+func (m tuiModel) enter() (tea.Model, tea.Cmd) {
+	switch m.view {
+	case tuiCards:
+		if len(m.cards) > 0 {
+			m.view = tuiDetail
+		}
+	case tuiSets:
+		if len(m.sets) > 0 {
+			set := m.sets[m.setCursor]
+			m.filter = CardFilter{Cmc: -1, Set: set.Code}
+			m.search.SetValue("set:" + set.Code)
+			m.view = tuiCards
+			return m, tuiLoadCards(m.client, m.filter)
+		}
+	}
+	return m, nil
+}
+
+// modify changes the amount of the selected card, without going below zero
+func (m tuiModel) modify(amount int64, finish string) tea.Cmd {
+	if m.view == tuiSets || len(m.cards) == 0 {
+		return nil
+	}
+
+	card := m.cards[m.cursor]
+	if card.getCount(finish)+amount < 0 {
+		return nil
+	}
+	return tuiModifyCount(m.client, card, amount, finish)
+}
+
+func (m tuiModel) listHeight() int {
+	// header, search, empty line, status and help
+	return max(m.height-6, 1)
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+
+	tabs := []string{"Cards", "Sets"}
+	for i, t := range tabs {
+		if tuiView(i) == m.view || (m.view == tuiDetail && i == 0) {
+			tabs[i] = tuiSelectedStyle.Render(" " + t + " ")
+		} else {
+			tabs[i] = " " + t + " "
+		}
+	}
+	b.WriteString(tuiTitleStyle.Render("Serra") + "  " + strings.Join(tabs, " ") + "\n")
+	b.WriteString(m.search.View() + "\n\n")
+
+	switch m.view {
+	case tuiCards:
+		b.WriteString(m.cardsView())
+	case tuiSets:
+		b.WriteString(m.setsView())
+	case tuiDetail:
+		b.WriteString(m.detailView())
+	}
+
+	if m.err != nil {
+		b.WriteString("\n" + tuiErrorStyle.Render(m.err.Error()))
+	} else {
+		b.WriteString("\n" + m.status)
+	}
+	b.WriteString("\n" + tuiMutedStyle.Render("tab: cards/sets  /: search  enter: open  +/-: normal  >/<: foil  esc: back  q: quit"))
+	return b.String()
+}
+
+// visible returns the range of list entries to show around the cursor
+func (m tuiModel) visible(cursor, length int) (int, int) {
+	height := m.listHeight()
+	start := max(cursor-height/2, 0)
+	end := min(start+height, length)
+	start = max(end-height, 0)
+	return start, end
+}
+
+func (m tuiModel) cardsView() string {
+	if len(m.cards) == 0 {
+		return tuiMutedStyle.Render("No cards found") + "\n"
+	}
+
+	var b strings.Builder
+	start, end := m.visible(m.cursor, len(m.cards))
+	for i := start; i < end; i++ {
+		c := m.cards[i]
+		line := fmt.Sprintf("%3dx %3d* %-40.40s %-5s %-5s %8.2f%s", c.SerraCount, c.SerraCountFoil, c.Name, c.Set, c.CollectorNumber, m.client.cardValue(c, false), m.client.currencySymbol())
+		if i == m.cursor {
+			line = tuiSelectedStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func (m tuiModel) setsView() string {
+	if len(m.sets) == 0 {
+		return tuiMutedStyle.Render("No sets found") + "\n"
+	}
+
+	var b strings.Builder
+	start, end := m.visible(m.setCursor, len(m.sets))
+	for i := start; i < end; i++ {
+		s := m.sets[i]
+		var completion float64
+		if s.CardCount > 0 {
+			completion = float64(s.Unique) / float64(s.CardCount)
+		}
+		line := fmt.Sprintf("%s %-30.30s %-5s %s %4d/%-4d %8.2f%s", s.Release[0:4], s.Name, s.Code, progressBar(completion, 20), s.Unique, s.CardCount, s.Value, m.client.currencySymbol())
+		if i == m.setCursor {
+			line = tuiSelectedStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func (m tuiModel) detailView() string {
+	c := m.cards[m.cursor]
+	v := m.client.valuation()
+
+	var b strings.Builder
+	b.WriteString(tuiTitleStyle.Render(c.Name) + fmt.Sprintf(" (%s/%s)\n", c.Set, c.CollectorNumber))
+	b.WriteString(fmt.Sprintf("%s, %s\n", c.SetName, c.Rarity))
+	b.WriteString(c.TypeLine + "\n")
+	if c.OracleText != "" {
+		b.WriteString(tuiMutedStyle.Render(c.OracleText) + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(fmt.Sprintf("Normal: %dx %s\n", c.SerraCount, tuiValueStyle.Render(fmt.Sprintf("%.2f%s", v.cardValue(c, false), v.symbol()))))
+	b.WriteString(fmt.Sprintf("Foil:   %dx %s\n", c.SerraCountFoil, tuiValueStyle.Render(fmt.Sprintf("%.2f%s", v.cardValue(c, true), v.symbol()))))
+	b.WriteString("\nValue History\n")
+
+	history := v.history(c)
+	values := []float64{}
+	for _, e := range history {
+		values = append(values, v.priceValue(e, false))
+	}
+	b.WriteString(asciiChart(values, max(m.width-12, 10), max(m.height-18, 4)))
+	if len(history) > 0 {
+		b.WriteString(tuiMutedStyle.Render(fmt.Sprintf("%s - %s", stringToTime(history[0].Date), stringToTime(history[len(history)-1].Date))) + "\n")
+	}
+	return b.String()
+}
+
+// progressBar renders a completion between 0 and 1 as bar of given width
+func progressBar(completion float64, width int) string {
+	filled := int(math.Round(math.Min(math.Max(completion, 0), 1) * float64(width)))
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+}
+
+// asciiChart plots values as a line chart with a scale on the left. Values
+// are sampled down to the given width.
+func asciiChart(values []float64, width, height int) string {
+	if len(values) == 0 {
+		return tuiMutedStyle.Render("No prices recorded yet") + "\n"
+	}
+
+	if len(values) > width {
+		sampled := make([]float64, width)
+		for i := range sampled {
+			sampled[i] = values[i*len(values)/width]
+		}
+		sampled[width-1] = values[len(values)-1]
+		values = sampled
+	}
+
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+
+	grid := make([][]rune, height)
+	for i := range grid {
+		grid[i] = []rune(strings.Repeat(" ", len(values)))
+	}
+	for x, v := range values {
+		y := 0
+		if high > low {
+			y = int(math.Round((v - low) / (high - low) * float64(height-1)))
+		}
+		grid[height-1-y][x] = '*'
+	}
+
+	var b strings.Builder
+	for i, row := range grid {
+		label := ""
+		switch i {
+		case 0:
+			label = fmt.Sprintf("%.2f", high)
+		case height - 1:
+			label = fmt.Sprintf("%.2f", low)
+		}
+		b.WriteString(fmt.Sprintf("%9s |%s\n", label, string(row)))
+	}
+	return b.String()
+}
+
+func clamp(v, low, high int) int {
+	if high < low {
+		return low
+	}
+	return min(max(v, low), high)
+}
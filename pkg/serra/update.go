@@ -1,7 +1,9 @@
 package serra
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -13,126 +15,334 @@ import (
 )
 
 func init() {
+	updateCmd.Flags().BoolVar(&all, "all", false, "Update all collections of the database, shared cards are fetched once")
+	updateCmd.Flags().StringVar(&mtgjsonFile, "mtgjson", "", "Also update prices of an MTGJSON AllPrices or AllPricesToday file")
+	updateCmd.Flags().StringVar(&mtgjsonIDs, "mtgjson-identifiers", "", "MTGJSON AllIdentifiers file to find cards of --mtgjson")
+	updateCmd.Flags().StringVar(&mtgjsonVendor, "mtgjson-vendor", "tcgplayer", "Vendor of the MTGJSON prices (tcgplayer/cardkingdom/cardmarket/...)")
+	updateCmd.Flags().StringVar(&mtgjsonList, "mtgjson-list", MTGJSONRetail, "MTGJSON price list (retail/buylist)")
+	updateCmd.Flags().StringVar(&cardmarketFile, "cardmarket", "", "Also update prices of a Cardmarket price guide JSON export")
 	rootCmd.AddCommand(updateCmd)
 }
 
 var updateCmd = &cobra.Command{
-	Aliases:       []string{"u"},
-	Use:           "update",
-	Short:         "Update card values from scryfall",
-	Long:          `The update mechanism iterates over each card in your collection and fetches its price. After all cards you own in a set are updated, the set value will update. After all Sets are updated, the whole collection value is updated.`,
+	Aliases: []string{"u"},
+	Use:     "update",
+	Short:   "Update card values from scryfall",
+	Long: `The update mechanism iterates over each card in your collection and fetches its price. After all cards you own in a set are updated, the set value will update. After all Sets are updated, the whole collection value is updated.
+
+Besides scryfall, prices of MTGJSON and Cardmarket files can be updated.
+Each provider keeps its own price history, select the one to value the
+collection by with "serra config set valuation_source <provider>".`,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-
-		client := storageConnect()
 		l := Logger()
-		defer storageDisconnect(client)
-
-		// update sets
-		setscoll := &Collection{client.Database("serra").Collection("sets")}
-		coll := &Collection{client.Database("serra").Collection("cards")}
-		totalcoll := &Collection{client.Database("serra").Collection("total")}
-
-		// predefine query for set analysis. used for total stats later
-		projectStage := bson.D{{"$project",
-			bson.D{
-				{"serra_count", true},
-				{"serra_count_foil", true},
-				{"set", true},
-				{"last_price", bson.D{{"$arrayElemAt", bson.A{"$serra_prices", -1}}}}}}}
-		groupStage := bson.D{
-			{"$group", bson.D{
-				{"_id", ""},
-				{"eur", bson.D{{"$sum", bson.D{{"$multiply", bson.A{"$last_price.eur", "$serra_count"}}}}}},
-				{"eurfoil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{"$last_price.eur_foil", "$serra_count_foil"}}}}}},
-				{"usd", bson.D{{"$sum", bson.D{{"$multiply", bson.A{"$last_price.usd", "$serra_count"}}}}}},
-				{"usdfoil", bson.D{{"$sum", bson.D{{"$multiply", bson.A{"$last_price.usd_foil", "$serra_count_foil"}}}}}},
-			}}}
-
-		sets, _ := fetchSets()
-		for _, set := range sets.Data {
-
-			// When downloading new sets, PriceList needs to be initialized
-			// This query silently fails if set was already downloaded. Not nice but ok for now.
-			set.SerraPrices = []PriceEntry{}
-			setscoll.storageAddSet(&set)
-
-			cards, _ := coll.storageFind(bson.D{{"set", set.Code}}, bson.D{{"_id", 1}}, 0, 0)
-
-			// if no cards in collection for this set, skip it
-			if len(cards) == 0 {
+
+		providers, err := readProviders()
+		if err != nil {
+			return err
+		}
+
+		client, err := newClient(WithPriceProviders(providers...))
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		names := []string{client.Collection()}
+		if all {
+			if names, err = client.Collections(); err != nil {
+				return err
+			}
+		}
+
+		cache := newScryfallCache(client.scryfall)
+		v := client.valuation()
+		failed := 0
+		for _, name := range names {
+			if all {
+				fmt.Printf("%sUpdating collection %s%s\n", Pink, name, Reset)
+			}
+
+			result, err := client.withCollection(name).update(cache, &updateBars{})
+			if all && errors.Is(err, errNoCards) {
+				l.Warnf("Skipping collection %s: %s", name, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("\n%sUpdated total value of collection %s to: %s%.02f%s%s\n\n", Green, name, Yellow, v.priceValue(result.Total, false)+v.priceValue(result.Total, true), v.symbol(), Reset)
+			failed += result.Failed
+		}
+
+		if failed > 0 {
+			l.Warnf("%d updates failed, see errors above", failed)
+		}
+		return nil
+	},
+}
+
+var errNoCards = errors.New("No cards in collection")
+
+// readProviders reads the price files given to update
+func readProviders() ([]PriceProvider, error) {
+	providers := []PriceProvider{}
+
+	if mtgjsonFile != "" {
+		if mtgjsonIDs == "" {
+			return nil, fmt.Errorf("MTGJSON prices need an AllIdentifiers file, see --mtgjson-identifiers")
+		}
+		prices, err := os.Open(mtgjsonFile)
+		if err != nil {
+			return nil, err
+		}
+		defer prices.Close()
+		ids, err := os.Open(mtgjsonIDs)
+		if err != nil {
+			return nil, err
+		}
+		defer ids.Close()
+
+		m, err := ReadMTGJSONPrices(prices, ids, mtgjsonVendor, mtgjsonList)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, m)
+	}
+
+	if cardmarketFile != "" {
+		f, err := os.Open(cardmarketFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		c, err := ReadCardmarketPriceGuide(f)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, c)
+	}
+	return providers, nil
+}
+
+// UpdateResult summarizes an update of the collection
+type UpdateResult struct {
+	Cards  int        // cards updated
+	Failed int        // cards and sets that failed to update
+	Total  PriceEntry // new value of the whole collection
+}
+
+// updateProgress is told about the progress of an update, i.e. to draw
+// progress bars
+type updateProgress interface {
+	startSet(set *Set, cards int)
+	cardDone()
+	setDone()
+}
+
+// updateBars draws a progress bar for each set
+type updateBars struct {
+	bar *progressbar.ProgressBar
+}
+
+func (u *updateBars) startSet(set *Set, cards int) {
+	u.bar = progressbar.NewOptions(cards,
+		progressbar.OptionSetWidth(50),
+		progressbar.OptionSetDescription(fmt.Sprintf("%s, %s%s%s\t", set.ReleasedAt[0:4], Yellow, set.Code, Reset)),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "|",
+			BarEnd:        set.Name,
+		}),
+	)
+}
+
+func (u *updateBars) cardDone() {
+	u.bar.Add(1)
+}
+
+func (u *updateBars) setDone() {
+	fmt.Println()
+}
+
+// update fetches the current prices of all cards, then sums up the value of
+// each set and of the whole collection. Failed cards and sets are logged and
+// skipped. progress may be nil.
+func (client *Client) update(fetch *scryfallCache, progress updateProgress) (*UpdateResult, error) {
+	l := Logger()
+
+	setscoll := client.sets()
+	coll := client.cards()
+	totalcoll := client.totals()
+
+	// predefine query for set analysis. used for total stats later. Sets and
+	// the collection are valued by the valuation source.
+	_, history := client.valuation().fields()
+	projectStage := bson.D{{"$project",
+		bson.D{
+			{"serra_count", true},
+			{"serra_count_foil", true},
+			{"serra_count_etched", true},
+			{"set", true},
+			{"last_price", bson.D{{"$arrayElemAt", bson.A{"$" + history, -1}}}}}}}
+	// values follow the price policy, so cards without a price of one
+	// currency do not drop out of its history. Etched copies are part of the
+	// foil value.
+	eur, usd := client.valuation(), client.valuation()
+	eur.currency, usd.currency = "EUR", "USD"
+	latest := client.rates.latest()
+	foilValue := func(v valuation) bson.D {
+		return bson.D{{"$sum", bson.D{{"$add", bson.A{
+			valueExpr(v.expr("$last_price", latest, true), "$serra_count_foil"),
+			valueExpr(v.finishExpr("$last_price", latest, FinishEtched), etchedCount),
+		}}}}}
+	}
+	groupStage := bson.D{
+		{"$group", bson.D{
+			{"_id", ""},
+			{"eur", bson.D{{"$sum", bson.D{{"$multiply", bson.A{eur.expr("$last_price", latest, false), "$serra_count"}}}}}},
+			{"eurfoil", foilValue(eur)},
+			{"usd", bson.D{{"$sum", bson.D{{"$multiply", bson.A{usd.expr("$last_price", latest, false), "$serra_count"}}}}}},
+			{"usdfoil", foilValue(usd)},
+		}}}
+
+	sets, err := fetch.fetchSets()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UpdateResult{}
+	for _, set := range sets.Data {
+
+		// When downloading new sets, PriceList needs to be initialized
+		// This query silently fails if set was already downloaded. Not nice but ok for now.
+		set.SerraPrices = []PriceEntry{}
+		setscoll.storageAddSet(&set)
+
+		cards, err := coll.storageFind(bson.D{{"set", set.Code}}, bson.D{{"_id", 1}}, 0, 0)
+		if err != nil {
+			l.Errorf("Skipping set %s: %s", set.Code, err)
+			result.Failed++
+			continue
+		}
+
+		// if no cards in collection for this set, skip it
+		if len(cards) == 0 {
+			continue
+		}
+
+		if progress != nil {
+			progress.startSet(&set, len(cards))
+		}
+
+		for _, card := range cards {
+			if progress != nil {
+				progress.cardDone()
+			}
+			updatedCard, err := fetch.fetchCard(card.Set, card.CollectorNumber)
+			if err != nil {
+				l.Error(err)
+				result.Failed++
 				continue
 			}
 
-			bar := progressbar.NewOptions(len(cards),
-				progressbar.OptionSetWidth(50),
-				progressbar.OptionSetDescription(fmt.Sprintf("%s, %s%s%s\t", set.ReleasedAt[0:4], Yellow, set.Code, Reset)),
-				progressbar.OptionEnableColorCodes(true),
-				progressbar.OptionShowCount(),
-				progressbar.OptionSetTheme(progressbar.Theme{
-					Saucer:        "[green]=[reset]",
-					SaucerHead:    "[green]>[reset]",
-					SaucerPadding: " ",
-					BarStart:      "|",
-					BarEnd:        set.Name,
-				}),
-			)
-
-			for _, card := range cards {
-				bar.Add(1)
-				updatedCard, err := fetchCard(card.Set, card.CollectorNumber)
+			now := primitive.NewDateTimeFromTime(time.Now())
+			fields := bson.M{"serra_updated": now, "cmc": updatedCard.Cmc, "cardmarketid": updatedCard.CardmarketID, "tcgplayerid": updatedCard.TCGPlayerID, "legalities": updatedCard.Legalities}
+			push := bson.M{}
+
+			// current prices and history of each provider, scryfall first
+			for _, provider := range append([]PriceProvider{scryfallPrices{}}, client.providers...) {
+				prices, err := provider.Prices(updatedCard)
 				if err != nil {
-					l.Error(err)
+					l.Errorf("Could not get prices of %s/%s from %s: %s", card.Set, card.CollectorNumber, provider.Name(), err)
+					continue
+				}
+				if prices == nil {
 					continue
 				}
+				prices.Date = now
+				current, history := providerFields(provider.Name())
+				fields[current] = prices
+				push[history] = prices
+			}
 
-				updatedCard.Prices.Date = primitive.NewDateTimeFromTime(time.Now())
+			// remember cards that rotated out since the last update
+			rotations := []Rotation{}
+			for _, f := range rotatedFormats(&card, updatedCard) {
+				rotations = append(rotations, Rotation{f, now})
+			}
+			if len(rotations) > 0 {
+				push["serra_rotated"] = bson.M{"$each": rotations}
+			}
 
-				update := bson.M{
-					"$set":  bson.M{"serra_updated": primitive.NewDateTimeFromTime(time.Now()), "prices": updatedCard.Prices, "cmc": updatedCard.Cmc, "cardmarketid": updatedCard.CardmarketID, "tcgplayerid": updatedCard.TCGPlayerID},
-					"$push": bson.M{"serra_prices": updatedCard.Prices},
-				}
-				coll.storageUpdate(bson.M{"_id": bson.M{"$eq": card.ID}}, update)
+			update := bson.M{
+				"$set":  fields,
+				"$push": push,
 			}
-			fmt.Println()
+			if err := coll.storageUpdate(bson.M{"_id": bson.M{"$eq": card.ID}}, update); err != nil {
+				l.Error(err)
+				result.Failed++
+				continue
+			}
+			result.Cards++
+		}
+		if progress != nil {
+			progress.setDone()
+		}
 
-			// update set value sum
+		// update set value sum
 
-			// calculate value summary
-			matchStage := bson.D{{"$match", bson.D{{"set", set.Code}}}}
-			setValue, _ := coll.storageAggregate(mongo.Pipeline{matchStage, projectStage, groupStage})
+		// calculate value summary
+		matchStage := bson.D{{"$match", bson.D{{"set", set.Code}}}}
+		setValue, err := coll.storageAggregate(mongo.Pipeline{matchStage, projectStage, groupStage})
+		if err != nil || len(setValue) == 0 {
+			l.Errorf("Could not calculate value of set %s: %v", set.Code, err)
+			result.Failed++
+			continue
+		}
 
-			p := PriceEntry{}
-			s := setValue[0]
+		p := PriceEntry{}
+		s := setValue[0]
 
-			p.Date = primitive.NewDateTimeFromTime(time.Now())
+		p.Date = primitive.NewDateTimeFromTime(time.Now())
 
-			// fill struct PriceEntry with map from mongoresult
-			mapstructure.Decode(s, &p)
+		// fill struct PriceEntry with map from mongoresult
+		mapstructure.Decode(s, &p)
 
-			// do the update
-			setUpdate := bson.M{
-				"$set":  bson.M{"serra_updated": p.Date, "cardcount": set.CardCount},
-				"$push": bson.M{"serra_prices": p},
-			}
-			// fmt.Printf("Set %s%s%s (%s) is now worth %s%.02f EUR%s\n", Pink, set.Name, Reset, set.Code, Yellow, setvalue[0]["value"], Reset)
-			setscoll.storageUpdate(bson.M{"code": bson.M{"$eq": set.Code}}, setUpdate)
+		// do the update
+		setUpdate := bson.M{
+			"$set":  bson.M{"serra_updated": p.Date, "cardcount": set.CardCount},
+			"$push": bson.M{"serra_prices": p},
 		}
+		// fmt.Printf("Set %s%s%s (%s) is now worth %s%.02f EUR%s\n", Pink, set.Name, Reset, set.Code, Yellow, setvalue[0]["value"], Reset)
+		if err := setscoll.storageUpdate(bson.M{"code": bson.M{"$eq": set.Code}}, setUpdate); err != nil {
+			l.Error(err)
+			result.Failed++
+		}
+	}
 
-		totalValue, _ := coll.storageAggregate(mongo.Pipeline{projectStage, groupStage})
-
-		t := PriceEntry{}
-		t.Date = primitive.NewDateTimeFromTime(time.Now())
-		mapstructure.Decode(totalValue[0], &t)
+	totalValue, err := coll.storageAggregate(mongo.Pipeline{projectStage, groupStage})
+	if err != nil {
+		return nil, err
+	}
+	if len(totalValue) == 0 {
+		return nil, errNoCards
+	}
 
-		// This is here to be able to fetch currency from
-		// constructed new priceentry
-		tmpCard := Card{}
-		tmpCard.Prices = t
+	t := PriceEntry{}
+	t.Date = primitive.NewDateTimeFromTime(time.Now())
+	mapstructure.Decode(totalValue[0], &t)
 
-		fmt.Printf("\n%sUpdating total value of collection to: %s%.02f%s%s\n", Green, Yellow, tmpCard.getValue(false)+tmpCard.getValue(true), getCurrency(), Reset)
-		totalcoll.storageAddTotal(t)
+	if err := totalcoll.storageAddTotal(t); err != nil {
+		return nil, err
+	}
+	result.Total = t
 
-		return nil
-	},
+	return result, nil
 }
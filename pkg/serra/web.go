@@ -1,8 +1,10 @@
 package serra
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/gin-gonic/gin"
@@ -12,8 +14,8 @@ import (
 )
 
 func init() {
-	webCmd.Flags().StringVarP(&address, "address", "a", "0.0.0.0", "Address to listen on")
-	webCmd.Flags().Uint64VarP(&port, "port", "p", 8080, "Port to listen on")
+	webCmd.Flags().StringVarP(&address, "address", "a", "0.0.0.0", "Address to listen on, default from config")
+	webCmd.Flags().Uint64VarP(&port, "port", "p", 8080, "Port to listen on, default from config")
 	rootCmd.AddCommand(webCmd)
 }
 
@@ -21,6 +23,10 @@ func add(a, b int64) int64 {
 	return a + b
 }
 
+func scryfallLink(uri string) string {
+	return strings.Replace(uri, "?utm_source=api", "", 1)
+}
+
 var webCmd = &cobra.Command{
 	Aliases:       []string{"a"},
 	Use:           "web",
@@ -28,38 +34,108 @@ var webCmd = &cobra.Command{
 	Long:          "Start a tiny web interface to have a web view of your collection",
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		startWeb()
-		return nil
+		if !cmd.Flags().Changed("address") {
+			address = settings.WebAddress
+		}
+		if !cmd.Flags().Changed("port") {
+			port = settings.WebPort
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		return client.startWeb()
 	},
 }
 
+type MoversQuery struct {
+	Window string  `form:"window"`
+	Sort   string  `form:"sort"`
+	Finish string  `form:"finish"`
+	Limit  float64 `form:"limit"`
+}
+
+// Selectable windows for tops and flops
+var moversWindows = []struct{ Value, Label string }{
+	{WindowLastUpdate, "Last update"},
+	{WindowWeek, "7 days"},
+	{WindowMonth, "30 days"},
+	{WindowQuarter, "90 days"},
+	{WindowAdded, "Since added"},
+}
+
 type Query struct {
-	Name  string `form:"name"`
-	Set   string `form:"set"`
-	Sort  string `form:"sort"`
-	Limit int64  `form:"limit"`
-	Page  int64  `form:"page"`
+	Name      string `form:"name"`
+	Q         string `form:"q"`
+	Set       string `form:"set"`
+	Color     string `form:"color"`
+	ColorMode string `form:"colormode"`
+	Sort      string `form:"sort"`
+	Limit     int64  `form:"limit"`
+	Page      int64  `form:"page"`
 }
 
-func startWeb() error {
+func (q Query) cardFilter() CardFilter {
+	return CardFilter{
+		Set:       q.Set,
+		Name:      q.Name,
+		Query:     q.Q,
+		Color:     q.Color,
+		ColorMode: q.ColorMode,
+		Cmc:       -1,
+	}
+}
+
+// Selectable modes for the color filter
+var colorModes = []struct{ Value, Label string }{
+	{ColorExact, "Exactly"},
+	{ColorIncludes, "Including"},
+	{ColorWithin, "Within"},
+}
+
+func (client *Client) startWeb() error {
 	router := gin.Default()
 	router.SetFuncMap(template.FuncMap{
-		"add": add,
+		"add":      add,
+		"currency": client.currencySymbol,
+		"scryfall": scryfallLink,
+		"value":    client.cardValue,
 	})
 	router.LoadHTMLGlob("templates/*.tmpl")
 	router.Static("/assets", "./assets")
 
 	// Landing page
-	router.GET("/", landingPage)
+	router.GET("/", client.landingPage)
+
+	// Detail pages
+	router.GET("/card/:set/:number", client.cardPage)
+	router.GET("/set/:code", client.setPage)
+	router.GET("/set/:code/missing", client.missingPage)
+
+	// Statistics
+	router.GET("/stats", client.statsPage)
+	router.GET("/movers", client.moversPage)
+	router.GET("/household", client.householdPage)
 
-	router.Run(address + ":" + strconv.FormatUint(port, 10))
-	return nil
+	// API
+	router.GET("/api/cards", client.cardsAPI)
+
+	return router.Run(address + ":" + strconv.FormatUint(port, 10))
 }
 
-func landingPage(c *gin.Context) {
+func (client *Client) landingPage(c *gin.Context) {
 	var query Query
 	if c.ShouldBind(&query) == nil {
 
+		filter, err := query.cardFilter().bson(client.priceField)
+		if err != nil {
+			errorPage(c, http.StatusBadRequest, err)
+			return
+		}
+
 		// Construct per Page results "limit"
 		strLimit := c.DefaultQuery("limit", "500")
 		limit, _ := strconv.ParseInt(strLimit, 10, 64)
@@ -68,25 +144,21 @@ func landingPage(c *gin.Context) {
 		}
 
 		// Fetch all sets for Dropdown
-		sets := Sets("release")
-
-		// Fetch all results based on filter criteria
-		cards := Cards("", query.Set, query.Sort, query.Name, "", "", false, false, query.Page*int64(limit), limit)
-
-		// Construct quick way for counting results
-		filter := bson.D{}
-		client := storageConnect()
-		coll := &Collection{client.Database("serra").Collection("cards")}
-
-		if query.Set != "" {
-			filter = append(filter, bson.E{"set", query.Set})
+		sets, err := client.aggregateSets("release")
+		if err != nil {
+			errorPage(c, http.StatusInternalServerError, err)
+			return
 		}
 
-		if query.Name != "" {
-			filter = append(filter, bson.E{"name", bson.D{{"$regex", ".*" + query.Name + ".*"}, {"$options", "i"}}})
+		// Fetch all results based on filter criteria
+		cards, err := client.findCards(query.cardFilter(), query.Sort, query.Page*int64(limit), limit)
+		if err != nil {
+			errorPage(c, errorStatus(err, http.StatusBadRequest), err)
+			return
 		}
 
-		counts, _ := coll.storageAggregate(mongo.Pipeline{
+		// Construct quick way for counting results
+		counts, err := client.cards().storageAggregate(mongo.Pipeline{
 			bson.D{
 				{"$match", filter},
 			},
@@ -96,7 +168,10 @@ func landingPage(c *gin.Context) {
 					{"count", bson.D{{"$sum", 1}}},
 				}}},
 		})
-		defer storageDisconnect(client)
+		if err != nil {
+			errorPage(c, http.StatusInternalServerError, err)
+			return
+		}
 
 		// Catch index error on no results
 		var numCards int32
@@ -104,11 +179,18 @@ func landingPage(c *gin.Context) {
 			numCards = counts[0]["count"].(int32)
 		}
 
+		var subtitle string
+		if query.Set != "" {
+			subtitle = "Set: " + query.Set
+		}
+
 		c.HTML(http.StatusOK, "index.tmpl", gin.H{
 			"title":    "Serra",
+			"subtitle": subtitle,
 			"cards":    cards,
 			"sets":     sets,
 			"query":    query,
+			"modes":    colorModes,
 			"version":  Version,
 			"prevPage": query.Page - 1,
 			"page":     query.Page,
@@ -119,3 +201,189 @@ func landingPage(c *gin.Context) {
 		})
 	}
 }
+
+// errorStatus returns a server error for failed storage operations and the
+// given status for anything else, like invalid input
+func errorStatus(err error, status int) int {
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+func errorPage(c *gin.Context, code int, err error) {
+	c.HTML(code, "error.tmpl", gin.H{
+		"title":   "Serra",
+		"version": Version,
+		"code":    code,
+		"error":   err.Error(),
+	})
+}
+
+func (client *Client) cardPage(c *gin.Context) {
+	card, err := findCardByCollectorNumber(client.cards(), c.Param("set"), c.Param("number"))
+	if err != nil {
+		errorPage(c, errorStatus(err, http.StatusNotFound), err)
+		return
+	}
+
+	v := client.valuation()
+	c.HTML(http.StatusOK, "card.tmpl", gin.H{
+		"title":     "Serra",
+		"subtitle":  card.Name,
+		"version":   Version,
+		"card":      card,
+		"added":     stringToTime(card.SerraCreated),
+		"value":     v.cardValue(*card, false),
+		"valueFoil": v.cardValue(*card, true),
+		"history":   priceHistoryChart(v, v.history(*card)),
+	})
+}
+
+func (client *Client) setPage(c *gin.Context) {
+	details, err := client.setDetails(c.Param("code"))
+	if err != nil {
+		errorPage(c, errorStatus(err, http.StatusNotFound), err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "set.tmpl", gin.H{
+		"title":    "Serra",
+		"subtitle": details.Set.Name,
+		"version":  Version,
+		"set":      details,
+		"history":  priceHistoryChart(client.valuation(), details.Set.SerraPrices),
+	})
+}
+
+func (client *Client) missingPage(c *gin.Context) {
+	set, cards, err := client.missingCards(c.Param("code"))
+	if err != nil {
+		errorPage(c, errorStatus(err, http.StatusNotFound), err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "missing.tmpl", gin.H{
+		"title":    "Serra",
+		"subtitle": "Missing in " + set.Name,
+		"version":  Version,
+		"set":      set,
+		"cards":    cards,
+	})
+}
+
+// StatsChart holds a statistic split into chart friendly series
+type StatsChart struct {
+	Labels []string
+	Values []float64
+}
+
+func statsChart(entries []StatsEntry) StatsChart {
+	chart := StatsChart{Labels: []string{}, Values: []float64{}}
+	for _, e := range entries {
+		chart.Labels = append(chart.Labels, e.Name)
+		chart.Values = append(chart.Values, e.Count)
+	}
+	return chart
+}
+
+func (client *Client) statsPage(c *gin.Context) {
+	stats, err := client.stats()
+	if err != nil {
+		errorPage(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	rarities := []StatsEntry{
+		{"Mythics", stats.Rarities.Mythics},
+		{"Rares", stats.Rarities.Rares},
+		{"Uncommons", stats.Rarities.Uncommons},
+		{"Commons", stats.Rarities.Commons},
+	}
+
+	c.HTML(http.StatusOK, "stats.tmpl", gin.H{
+		"title":         "Serra",
+		"subtitle":      "Statistics",
+		"version":       Version,
+		"stats":         stats,
+		"history":       priceHistoryChart(client.valuation(), stats.History),
+		"rarities":      statsChart(rarities),
+		"colors":        statsChart(stats.Colors),
+		"artists":       statsChart(stats.Artists),
+		"manaCurve":     statsChart(stats.ManaCurve),
+		"addedPerMonth": statsChart(stats.AddedPerMonth),
+	})
+}
+
+func (client *Client) moversPage(c *gin.Context) {
+	var query MoversQuery
+	if err := c.ShouldBind(&query); err != nil {
+		errorPage(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if query.Window == "" {
+		query.Window = WindowLastUpdate
+	}
+
+	tops, err := client.gains(query.Window, query.Sort, query.Finish, query.Limit, -1)
+	if err != nil {
+		errorPage(c, errorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	flops, err := client.gains(query.Window, query.Sort, query.Finish, query.Limit, 1)
+	if err != nil {
+		errorPage(c, errorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "movers.tmpl", gin.H{
+		"title":     "Serra",
+		"subtitle":  "Tops & Flops",
+		"version":   Version,
+		"query":     query,
+		"windows":   moversWindows,
+		"topCards":  tops.Cards,
+		"topSets":   tops.Sets,
+		"flopCards": flops.Cards,
+		"flopSets":  flops.Sets,
+		"unpriced":  tops.Unpriced,
+	})
+}
+
+func (client *Client) householdPage(c *gin.Context) {
+	household, err := client.household()
+	if err != nil {
+		errorPage(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.HTML(http.StatusOK, "household.tmpl", gin.H{
+		"title":     "Serra",
+		"subtitle":  "Household",
+		"version":   Version,
+		"household": household,
+	})
+}
+
+// cardsAPI returns the cards matching a search query as json
+func (client *Client) cardsAPI(c *gin.Context) {
+	var query Query
+	if err := c.ShouldBind(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Limit == 0 {
+		query.Limit = 500
+	}
+
+	cards, err := client.findCards(query.cardFilter(), query.Sort, query.Page*query.Limit, query.Limit)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newCardList(client.valuation(), cards))
+}